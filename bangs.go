@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Placeholder in bang URLs that is replaced with the search query.
+//
+// This is the same placeholder that DuckDuckGo uses, so their bang list can
+// be imported as-is.
+const bangPlaceholder = "{{{s}}}"
+
+// A bang redirects searches to another website, such as "!w" to Wikipedia.
+type bang struct {
+	// Trigger is the text after the "!", e.g. "w".
+	Trigger string
+
+	// Name of the website, if known.
+	Name string
+
+	// URL to redirect to; [bangPlaceholder] is replaced by the query.
+	URL string
+}
+
+// An entry of a bang list file.
+//
+// This uses the format of DuckDuckGo's bang.json; all other fields are
+// ignored.
+type bangFileEntry struct {
+	Trigger string `json:"t"`
+	Name    string `json:"s"`
+	URL     string `json:"u"`
+}
+
+// Holds all known bangs.
+type bangList struct {
+	bangs map[string]bang
+}
+
+// Creates a new, empty bang list.
+func newBangList() *bangList {
+	return &bangList{
+		bangs: map[string]bang{},
+	}
+}
+
+// Checks that a bang URL will result in a valid link.
+func validateBangURL(link string) error {
+	u, err := url.Parse(strings.ReplaceAll(link, bangPlaceholder, ""))
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("bang URL %q must be http or https", link)
+	}
+
+	return nil
+}
+
+// Adds a bang to the list, replacing any bang with the same trigger.
+//
+// Triggers are case-insensitive.
+func (b *bangList) Add(trigger, name, link string) error {
+	trigger = strings.ToLower(strings.TrimPrefix(trigger, "!"))
+	if trigger == "" {
+		return fmt.Errorf("empty bang trigger")
+	}
+
+	if err := validateBangURL(link); err != nil {
+		return err
+	}
+
+	b.bangs[trigger] = bang{
+		Trigger: trigger,
+		Name:    name,
+		URL:     link,
+	}
+	return nil
+}
+
+// Loads bangs from a file in the format of DuckDuckGo's bang.json.
+//
+// Returns the number of bangs loaded.
+// Invalid bangs are skipped.
+func (b *bangList) LoadFile(path string) (int, error) {
+	h, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer h.Close()
+
+	var entries []bangFileEntry
+	if err := json.NewDecoder(h).Decode(&entries); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, v := range entries {
+		if b.Add(v.Trigger, v.Name, v.URL) == nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Returns the number of bangs in the list.
+func (b *bangList) Len() int {
+	return len(b.bangs)
+}
+
+// Returns all bangs, sorted by trigger.
+func (b *bangList) List() []bang {
+	out := make([]bang, 0, len(b.bangs))
+	for _, v := range b.bangs {
+		out = append(out, v)
+	}
+
+	slices.SortFunc(out, func(a, b bang) int {
+		return strings.Compare(a.Trigger, b.Trigger)
+	})
+	return out
+}
+
+// Determines where a query should be redirected to.
+//
+// The first word of the query that is a known bang is used, and the rest of
+// the query is searched for on the bang's website.
+// If the rest of the query is empty, the user is sent to the front page of
+// the website instead.
+func (b *bangList) Redirect(query string) (string, bool) {
+	if !strings.ContainsRune(query, '!') {
+		// Can't possibly contain a bang.
+		return "", false
+	}
+
+	toks := strings.Fields(query)
+
+	for i, tok := range toks {
+		if !strings.HasPrefix(tok, "!") {
+			continue
+		}
+
+		v, ok := b.bangs[strings.ToLower(tok[1:])]
+		if !ok {
+			continue
+		}
+
+		rest := strings.Join(slices.Delete(toks, i, i+1), " ")
+		if rest == "" {
+			u, _ := url.Parse(strings.ReplaceAll(v.URL, bangPlaceholder, ""))
+			return u.Scheme + "://" + u.Host + "/", true
+		}
+
+		// QueryEscape encodes spaces as "+", which is only valid in the
+		// query string; %20 works everywhere.
+		escaped := strings.ReplaceAll(url.QueryEscape(rest), "+", "%20")
+		return strings.ReplaceAll(v.URL, bangPlaceholder, escaped), true
+	}
+
+	return "", false
+}
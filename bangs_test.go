@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBangRedirect(t *testing.T) {
+	b := newBangList()
+	b.Add("w", "Wikipedia", "https://en.wikipedia.org/w/index.php?search={{{s}}}")
+	b.Add("!GH", "GitHub", "https://github.com/search?q={{{s}}}")
+
+	tests := []struct {
+		in, out string
+	}{
+		{"!w golang", "https://en.wikipedia.org/w/index.php?search=golang"},
+		{"go programming language !w", "https://en.wikipedia.org/w/index.php?search=go%20programming%20language"},
+		{"!gh a&b", "https://github.com/search?q=a%26b"},
+		{"!GH srchd", "https://github.com/search?q=srchd"},
+		{"!w", "https://en.wikipedia.org/"},
+		{"!unknown !w test", "https://en.wikipedia.org/w/index.php?search=%21unknown%20test"},
+		{"!unknown test", ""},
+		{"hello! world", ""},
+	}
+
+	for _, v := range tests {
+		t.Run(v.in, func(t *testing.T) {
+			res, ok := b.Redirect(v.in)
+			if ok != (v.out != "") || res != v.out {
+				t.Errorf("%q != %q", res, v.out)
+			}
+		})
+	}
+}
+
+func TestBangLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bang.json")
+	err := os.WriteFile(path, []byte(`[
+		{"s": "Wikipedia", "t": "w", "u": "https://en.wikipedia.org/wiki/Special:Search?search={{{s}}}", "d": "en.wikipedia.org"},
+		{"s": "Invalid", "t": "bad", "u": "javascript:alert({{{s}}})"}
+	]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := newBangList()
+	n, err := b.LoadFile(path)
+	if err != nil {
+		t.Fatalf("failed to load bangs: %v", err)
+	}
+
+	if n != 1 || b.Len() != 1 {
+		t.Errorf("loaded %d bangs, want 1", n)
+	}
+
+	if res := b.List(); res[0].Name != "Wikipedia" {
+		t.Errorf("unexpected bang: %v", res[0])
+	}
+}
@@ -101,11 +101,16 @@ func (b *Blacklist) AddRegexp(rule string) error {
 }
 
 // Returns true if the link should be filtered by the blacklist.
+//
+// The link is checked in both its normalized and canonical form (see
+// [canonicalLink]), so a rule for "http://www.example.com/*" also applies to
+// "https://example.com/".
 func (b *Blacklist) Contains(link string) bool {
-	link = normalizeLink(link)
+	normalized := normalizeLink(link)
+	canonical := canonicalLink(link)
 
 	for _, re := range b.regexps {
-		if re.MatchString(link) {
+		if re.MatchString(normalized) || re.MatchString(canonical) {
 			return true
 		}
 	}
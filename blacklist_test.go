@@ -182,3 +182,22 @@ func TestBlacklistFilter(t *testing.T) {
 		t.Errorf("expected %+v, got %+v", exp, act)
 	}
 }
+
+func TestBlacklistCanonical(t *testing.T) {
+	b := newBlacklist()
+
+	b.AddPattern("https://example.com/*")
+
+	test := []string{
+		"https://example.com/",
+		"http://example.com/abc",
+		"https://www.example.com/abc",
+		"https://EXAMPLE.com:443/abc",
+	}
+
+	for _, v := range test {
+		if !b.Contains(v) {
+			t.Errorf("rule does not match %q", v)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// Returned instead of searching an engine that has been suspended.
+var errSuspended = errors.New("engine suspended after repeated errors")
+
+// The state of a [circuitBreaker].
+type breakerState int
+
+const (
+	// The engine is searched as usual.
+	breakerClosed breakerState = iota
+
+	// The engine is suspended until the backoff has passed.
+	breakerOpen
+
+	// The backoff has passed and a single trial search decides whether
+	// the engine is brought back.
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "ok"
+	case breakerOpen:
+		return "suspended"
+	case breakerHalfOpen:
+		return "trial"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops searching an engine that keeps failing.
+//
+// After threshold consecutive errors, or on the first captcha, the engine is
+// suspended for a backoff that doubles every time the engine is suspended
+// again, up to maxBackoff.
+// Once the backoff has passed a single search is let through; if it succeeds
+// the engine is brought back, otherwise it is suspended again.
+//
+// A nil *circuitBreaker is valid and never suspends anything.
+type circuitBreaker struct {
+	threshold  int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	trips    int
+	until    time.Time
+	trial    bool
+	lastErr  error
+}
+
+// A snapshot of the state of a [circuitBreaker] for display.
+type breakerStatus struct {
+	State    breakerState
+	Failures int
+	Until    time.Time
+	LastErr  error
+}
+
+// Suspended determines if the engine is currently not being searched.
+func (s breakerStatus) Suspended() bool {
+	return s.State == breakerOpen
+}
+
+var breakers = map[string]*circuitBreaker{}
+var breakersMu sync.Mutex
+
+// Creates a new circuit breaker.
+//
+// If threshold is not positive, newCircuitBreaker returns nil which disables
+// suspending altogether.
+func newCircuitBreaker(threshold int, backoff, maxBackoff time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+
+	return &circuitBreaker{
+		threshold:  threshold,
+		backoff:    backoff,
+		maxBackoff: max(backoff, maxBackoff),
+	}
+}
+
+// Returns the circuit breaker of an engine, creating it if needed.
+func engineBreaker(name string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[name]
+	if !ok {
+		b = newCircuitBreaker(cfg().Breaker.Threshold, cfg().Breaker.Backoff.Duration, cfg().Breaker.MaxBackoff.Duration)
+		breakers[name] = b
+	}
+	return b
+}
+
+// Returns the state of the circuit breaker of an engine.
+func getEngineBreakerStatus(name string) breakerStatus {
+	return engineBreaker(name).Status()
+}
+
+// Determines if the engine may be searched.
+//
+// Suspended engines return an error wrapping errSuspended.
+// When the backoff has passed, Allow returns nil exactly once for the trial
+// search; the outcome of every search that was allowed must be given to
+// Record.
+func (b *circuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.until); wait > 0 {
+			return fmt.Errorf("%w; retrying in %v", errSuspended, wait.Round(time.Second))
+		}
+
+		b.state = breakerHalfOpen
+		b.trial = true
+		return nil
+	case breakerHalfOpen:
+		if b.trial {
+			return fmt.Errorf("%w; retrying now", errSuspended)
+		}
+
+		// The last trial was cancelled; try again.
+		b.trial = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Records the outcome of a search let through by Allow.
+func (b *circuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+
+	if err == nil {
+		b.state = breakerClosed
+		b.failures = 0
+		b.trips = 0
+		b.lastErr = nil
+		return
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, search.ErrRateLimited) {
+		// The search was abandoned or never sent, which says nothing
+		// about the engine.
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+
+	if b.state == breakerHalfOpen || b.failures >= b.threshold || errors.Is(err, search.ErrCaptcha) {
+		b.trip()
+	}
+}
+
+// Suspends the engine, doubling the backoff each time.
+//
+// b.mu must be held.
+func (b *circuitBreaker) trip() {
+	backoff := b.backoff
+	for range b.trips {
+		backoff *= 2
+		if backoff >= b.maxBackoff {
+			break
+		}
+	}
+	backoff = min(backoff, b.maxBackoff)
+
+	b.state = breakerOpen
+	b.until = time.Now().Add(backoff)
+	b.trips++
+}
+
+// Returns a snapshot of the state of the circuit breaker.
+func (b *circuitBreaker) Status() breakerStatus {
+	if b == nil {
+		return breakerStatus{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == breakerOpen && !time.Now().Before(b.until) {
+		// The next search will be the trial.
+		state = breakerHalfOpen
+	}
+
+	return breakerStatus{
+		State:    state,
+		Failures: b.failures,
+		Until:    b.until,
+		LastErr:  b.lastErr,
+	}
+}
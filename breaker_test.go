@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+var errTest = errors.New("test error")
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(3, time.Minute, time.Hour)
+
+	for range 2 {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("engine suspended early: %v", err)
+		}
+		b.Record(errTest)
+	}
+
+	// A success resets the count.
+	b.Record(nil)
+
+	for i := range 3 {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("engine suspended after %d errors: %v", i, err)
+		}
+		b.Record(errTest)
+	}
+
+	if err := b.Allow(); !errors.Is(err, errSuspended) {
+		t.Fatalf("engine not suspended after 3 errors: err = %v", err)
+	}
+
+	// Skip the backoff; only one trial is let through.
+	b.until = time.Now()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial not allowed: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, errSuspended) {
+		t.Fatalf("second trial allowed while the first is running")
+	}
+
+	b.Record(nil)
+	if s := b.Status(); s.State != breakerClosed || s.Failures != 0 {
+		t.Errorf("engine not brought back after trial: %+v", s)
+	}
+}
+
+func TestCircuitBreakerCaptcha(t *testing.T) {
+	b := newCircuitBreaker(5, time.Minute, time.Hour)
+
+	b.Allow()
+	b.Record(search.ErrCaptcha)
+
+	if err := b.Allow(); !errors.Is(err, errSuspended) {
+		t.Errorf("engine not suspended after captcha: err = %v", err)
+	}
+}
+
+func TestCircuitBreakerBackoff(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute, 3*time.Minute)
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		// Every failed trial suspends the engine for longer.
+		b.until = time.Now()
+		b.Allow()
+		b.Record(errTest)
+
+		if got := time.Until(b.until).Round(time.Minute); got != want {
+			t.Errorf("backoff = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCircuitBreakerNeutral(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute, time.Hour)
+
+	// Neither of these reached the engine.
+	for _, v := range []error{context.Canceled, search.ErrRateLimited} {
+		b.Allow()
+		b.Record(v)
+
+		if err := b.Allow(); err != nil {
+			t.Errorf("engine suspended after %v: %v", v, err)
+		}
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute, time.Hour)
+
+	for range 10 {
+		b.Record(search.ErrCaptcha)
+	}
+
+	if err := b.Allow(); err != nil {
+		t.Errorf("disabled breaker suspended engine: %v", err)
+	}
+}
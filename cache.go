@@ -0,0 +1,154 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// resultCache is a bounded LRU cache of raw engine results.
+//
+// Results are stored per engine before the blacklist and rewrite rules are
+// applied, so changes to either will always be reflected in results served
+// from the cache.
+//
+// A nil *resultCache is valid and never stores anything.
+type resultCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// A single entry in a [resultCache].
+type cacheEntry struct {
+	key     string
+	results []search.Result
+	expires time.Time
+}
+
+// Creates a new result cache.
+//
+// If size or ttl is not positive, newResultCache returns nil which disables
+// caching altogether.
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	return &resultCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Normalizes a query for use in a cache key.
+//
+// Queries that differ only in whitespace are considered to be the same.
+// Case is kept, as it changes the meaning of operators such as OR.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// Determines the cache key for an engine's results.
+//
+// The engine name is part of the key, so a search on any set of engines will
+// only ever use the results of the engines in that set.
+func cacheKey(engine string, req engineRequest) string {
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%s\x00%s", engine, req.Category, req.Page, req.Options, normalizeQuery(req.Query))
+}
+
+// Makes a copy of res that shares no memory with the original.
+//
+// This is necessary because the blacklist and processResults both modify the
+// slices they are given.
+func cloneResults(res []search.Result) []search.Result {
+	out := slices.Clone(res)
+	for i := range out {
+		out[i].Sources = slices.Clone(out[i].Sources)
+		out[i].Alternates = slices.Clone(out[i].Alternates)
+	}
+	return out
+}
+
+// Fetches the results for a key from the cache.
+//
+// The returned slice is a copy and may be modified freely.
+func (c *resultCache) Get(key string) ([]search.Result, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	ent := elem.Value.(*cacheEntry)
+	if time.Now().After(ent.expires) {
+		// Stale; drop it.
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return cloneResults(ent.results), true
+}
+
+// Stores results in the cache, evicting the least recently used entry if the
+// cache is full.
+func (c *resultCache) Put(key string, res []search.Result) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ent := &cacheEntry{
+		key:     key,
+		results: cloneResults(res),
+		expires: time.Now().Add(c.ttl),
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		// Replace the existing entry.
+		elem.Value = ent
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(ent)
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Returns the number of entries in the cache, including expired ones that
+// have not been evicted yet.
+func (c *resultCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+func TestResultCache(t *testing.T) {
+	c := newResultCache(2, time.Minute)
+
+	c.Put(cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "hello world", Page: 0}), []search.Result{{Link: "1", Sources: []string{"a"}}})
+
+	// Whitespace shouldn't matter.
+	res, ok := c.Get(cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "  hello   world ", Page: 0}))
+	if !ok || len(res) != 1 || res[0].Link != "1" {
+		t.Fatalf("expected cached result, got %+v (ok = %v)", res, ok)
+	}
+
+	// Modifying the returned slice must not change the cache.
+	res[0].Sources[0] = "b"
+	res, _ = c.Get(cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "hello world", Page: 0}))
+	if res[0].Sources[0] != "a" {
+		t.Errorf("cache entry was modified through returned slice")
+	}
+
+	// Different engine, page, category or options is a different entry.
+	if _, ok := c.Get(cacheKey("b", engineRequest{Category: search.CategoryWeb, Query: "hello world", Page: 0})); ok {
+		t.Errorf("got cache hit for different engine")
+	}
+	if _, ok := c.Get(cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "hello world", Page: 1})); ok {
+		t.Errorf("got cache hit for different page")
+	}
+	if _, ok := c.Get(cacheKey("a", engineRequest{Category: search.CategoryNews, Query: "hello world", Page: 0})); ok {
+		t.Errorf("got cache hit for different category")
+	}
+	if _, ok := c.Get(cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "hello world", Options: search.Options{Language: "de"}})); ok {
+		t.Errorf("got cache hit for different options")
+	}
+}
+
+func TestCacheKeyCase(t *testing.T) {
+	// "or" is a plain word, but "OR" is an operator.
+	a := cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "cats OR dogs"})
+	b := cacheKey("a", engineRequest{Category: search.CategoryWeb, Query: "cats or dogs"})
+	if a == b {
+		t.Errorf("%q and %q have the same cache key", "cats OR dogs", "cats or dogs")
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	c := newResultCache(2, time.Minute)
+
+	for i := range 3 {
+		c.Put(fmt.Sprint(i), []search.Result{{Link: fmt.Sprint(i)}})
+	}
+
+	if c.Len() != 2 {
+		t.Errorf("expected len = 2, got %d", c.Len())
+	}
+
+	if _, ok := c.Get("0"); ok {
+		t.Errorf("least recently used entry was not evicted")
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	c := newResultCache(2, time.Millisecond)
+
+	c.Put("a", []search.Result{{Link: "a"}})
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("got expired entry")
+	}
+}
+
+func TestResultCacheNil(t *testing.T) {
+	var c *resultCache
+
+	c.Put("a", []search.Result{{Link: "a"}})
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("nil cache returned an entry")
+	}
+}
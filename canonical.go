@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Canonicalizes links so that different links to the same page compare equal.
+//
+// The canonical form of a link is only ever used for comparisons; it is never
+// shown to the user, as it may not even be a working link.
+// Each field enables a rule; the host is always lowercased and the fragment
+// is always dropped.
+type canonicalizer struct {
+	// Treat http:// and https:// as the same.
+	Scheme bool `yaml:"scheme"`
+
+	// Treat "www.example.com" and "example.com" as the same.
+	WWW bool `yaml:"www"`
+
+	// Treat "/path/" and "/path" as the same.
+	TrailingSlash bool `yaml:"trailing_slash"`
+
+	// Drop ports that are the default for the scheme, such as :443 for
+	// https.
+	DefaultPort bool `yaml:"default_port"`
+
+	// Uppercase percent-encoded bytes and decode those that don't need to
+	// be encoded, so "%7e" and "~" are the same.
+	PercentEncoding bool `yaml:"percent_encoding"`
+
+	// Convert internationalized domain names to punycode, so "bücher.de"
+	// and "xn--bcher-kva.de" are the same.
+	IDN bool `yaml:"idn"`
+
+	// Sort query parameters by name, so "?a=1&b=2" and "?b=2&a=1" are the
+	// same.
+	SortQuery bool `yaml:"sort_query"`
+}
+
+// Default ports of schemes that srchd is likely to see.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize returns the canonical form of link.
+//
+// Links that can't be parsed or that have no host are returned as-is.
+func (c canonicalizer) Canonicalize(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	// Fragments never point to a different page.
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+
+	if c.DefaultPort && defaultPorts[u.Scheme] == port {
+		port = ""
+	}
+
+	if c.Scheme && u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+
+	if c.IDN {
+		if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+			host = ascii
+		}
+	}
+
+	if c.WWW {
+		host = strings.TrimPrefix(host, "www.")
+	}
+
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		// IPv6 addresses keep their brackets without a port too.
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	path := u.EscapedPath()
+	if c.PercentEncoding {
+		path = normalizePercentEncoding(path)
+	}
+
+	if c.TrailingSlash {
+		path = strings.TrimRight(path, "/")
+	}
+
+	if path == "" {
+		// At minimum it should be "/"
+		path = "/"
+	}
+
+	// Setting RawPath alone would be ignored if it isn't a valid encoding
+	// of Path.
+	u.Path, err = url.PathUnescape(path)
+	if err != nil {
+		return link
+	}
+	u.RawPath = path
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if c.SortQuery && u.RawQuery != "" && err == nil {
+		// Encode sorts by key.
+		// Queries that can't be parsed are kept as they are, since
+		// Encode would leave out the pairs it couldn't parse.
+		u.RawQuery = query.Encode()
+	} else if c.PercentEncoding {
+		u.RawQuery = normalizePercentEncoding(u.RawQuery)
+	}
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// Determines if a byte never needs to be percent-encoded.
+//
+// See section 2.3 of RFC 3986.
+func isUnreserved(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '-' || b == '.' || b == '_' || b == '~'
+}
+
+// Uppercases all percent-encoded bytes in s, and decodes those which are
+// unreserved.
+func normalizePercentEncoding(s string) string {
+	if !strings.ContainsRune(s, '%') {
+		return s
+	}
+
+	const hex = "0123456789ABCDEF"
+
+	out := strings.Builder{}
+	out.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		hi := strings.IndexByte(hex, upper(s[i+1]))
+		lo := strings.IndexByte(hex, upper(s[i+2]))
+		if hi == -1 || lo == -1 {
+			// Not actually an escape.
+			out.WriteByte(s[i])
+			continue
+		}
+
+		if b := byte(hi<<4 | lo); isUnreserved(b) {
+			out.WriteByte(b)
+		} else {
+			out.WriteByte('%')
+			out.WriteByte(hex[hi])
+			out.WriteByte(hex[lo])
+		}
+		i += 2
+	}
+
+	return out.String()
+}
+
+// Uppercases an ASCII letter.
+func upper(b byte) byte {
+	if 'a' <= b && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
+}
+
+// Returns the canonical form of a link using the configured rules.
+func canonicalLink(link string) string {
+	return cfg().Canonicalize.Canonicalize(link)
+}
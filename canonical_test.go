@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	c := defaultConfig.Canonicalize
+
+	tests := []struct {
+		a, b string
+	}{
+		{"http://example.com/", "https://example.com/"},
+		{"https://www.example.com/", "https://example.com/"},
+		{"https://example.com/abc/", "https://example.com/abc"},
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com:443/", "https://example.com/"},
+		{"http://example.com:80/", "https://example.com/"},
+		{"https://example.com/%7euser", "https://example.com/~user"},
+		{"https://example.com/a%2fb", "https://example.com/a%2Fb"},
+		{"https://bücher.de/", "https://xn--bcher-kva.de/"},
+		{"https://example.com/?b=2&a=1", "https://example.com/?a=1&b=2"},
+		{"https://EXAMPLE.com/#section", "https://example.com/"},
+		{"http://[::1]:80/a", "https://[::1]/a"},
+	}
+
+	for _, test := range tests {
+		a, b := c.Canonicalize(test.a), c.Canonicalize(test.b)
+		if a != b {
+			t.Errorf("%q and %q have different canonical forms %q and %q", test.a, test.b, a, b)
+		}
+	}
+
+	different := []struct {
+		a, b string
+	}{
+		{"https://example.com/abc", "https://example.com/ABC"},
+		{"https://example.com:8080/", "https://example.com/"},
+		{"https://example.com/?a=1", "https://example.com/?a=2"},
+		{"https://m.example.com/", "https://example.com/"},
+		{"https://example.com/?x=1;y=2", "https://example.com/"},
+		{"https://example.com/?x=1;y=2", "https://example.com/?x=1;y=3"},
+	}
+
+	for _, test := range different {
+		a, b := c.Canonicalize(test.a), c.Canonicalize(test.b)
+		if a == b {
+			t.Errorf("%q and %q have the same canonical form %q", test.a, test.b, a)
+		}
+	}
+}
+
+func TestCanonicalizeDisabled(t *testing.T) {
+	c := canonicalizer{}
+
+	tests := []struct {
+		a, b string
+	}{
+		{"http://example.com/", "https://example.com/"},
+		{"https://www.example.com/", "https://example.com/"},
+		{"https://example.com/abc/", "https://example.com/abc"},
+		{"https://example.com/?b=2&a=1", "https://example.com/?a=1&b=2"},
+	}
+
+	for _, test := range tests {
+		a, b := c.Canonicalize(test.a), c.Canonicalize(test.b)
+		if a == b {
+			t.Errorf("%q and %q have the same canonical form %q with all rules disabled", test.a, test.b, a)
+		}
+	}
+}
+
+func TestCanonicalizeForm(t *testing.T) {
+	c := defaultConfig.Canonicalize
+
+	tests := []struct {
+		in, out string
+	}{
+		{"http://[::1]:8080/a", "https://[::1]:8080/a"},
+		{"http://[::1]/a", "https://[::1]/a"},
+		{"https://example.com/?x=1;y=2", "https://example.com/?x=1;y=2"},
+	}
+
+	for _, test := range tests {
+		if out := c.Canonicalize(test.in); out != test.out {
+			t.Errorf("expected %q to be canonicalized to %q, got %q", test.in, test.out, out)
+		}
+	}
+}
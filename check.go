@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+	"gopkg.in/yaml.v3"
+)
+
+// Checks a configuration file for every problem that would stop srchd from
+// starting, as well as mistakes that loadConfig lets through: unknown keys,
+// engines of unknown types, engine settings that the engine doesn't accept,
+// and blacklists and bang files that can't be read.
+//
+// Problems that can be pinned to a line are returned as *configError.
+func checkConfig(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []error{err}
+	}
+
+	var problems []error
+
+	// Problems found by loading the configuration normally.
+	c, err := loadConfig(path)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	if len(doc.Content) == 0 {
+		// The file is empty.
+		return problems
+	}
+	root := doc.Content[0]
+
+	problems = append(problems, checkKeys(root, reflect.TypeFor[config](), "")...)
+
+	configDir := filepath.Dir(path)
+
+	if _, engines := yamlLookup(root, "engines"); engines != nil && engines.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(engines.Content); i += 2 {
+			problems = append(problems, checkEngine(c, engines.Content[i], engines.Content[i+1])...)
+		}
+	}
+
+	if _, disabled := yamlLookup(root, "disabled"); disabled != nil {
+		for _, v := range disabled.Content {
+			if !slices.Contains(search.Supported(), v.Value) && !isConfiguredEngine(root, v.Value) {
+				problems = append(problems, &configError{v.Line, fmt.Errorf("disabled: unknown engine %q", v.Value)})
+			}
+		}
+	}
+
+	if _, files := yamlLookup(root, "blacklists"); files != nil {
+		for _, v := range files.Content {
+			if _, err := newBlacklist().LoadFile(configPathJoin(configDir, v.Value)); err != nil {
+				problems = append(problems, &configError{v.Line, fmt.Errorf("blacklist %q: %w", v.Value, err)})
+			}
+		}
+	}
+
+	if _, files := yamlLookup(root, "bang_files"); files != nil {
+		for _, v := range files.Content {
+			if _, err := newBangList().LoadFile(configPathJoin(configDir, v.Value)); err != nil {
+				problems = append(problems, &configError{v.Line, fmt.Errorf("bang file %q: %w", v.Value, err)})
+			}
+		}
+	}
+
+	// Problems without a line come first.
+	slices.SortStableFunc(problems, func(a, b error) int {
+		return problemLine(a) - problemLine(b)
+	})
+
+	return problems
+}
+
+// Returns the line of a problem, or 0 if it has none.
+func problemLine(err error) int {
+	if cerr, ok := err.(*configError); ok {
+		return cerr.Line
+	}
+	return 0
+}
+
+// Resolves a path relative to the configuration file directory.
+func configPathJoin(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Determines if an engine is configured under engines.
+func isConfiguredEngine(root *yaml.Node, name string) bool {
+	_, engines := yamlLookup(root, "engines")
+	if engines == nil {
+		return false
+	}
+
+	k, _ := yamlLookup(engines, name)
+	return k != nil
+}
+
+// Returns the key a struct field is decoded from.
+func yamlKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		// The default of the YAML decoder.
+		name = strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// Reports the keys of a mapping that have no field in t, and the keys of
+// every mapping nested in it.
+//
+// Engines are not checked here; see [checkEngine].
+func checkKeys(data *yaml.Node, t reflect.Type, prefix string) []error {
+	var problems []error
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if data.Kind == yaml.SequenceNode {
+			for _, v := range data.Content {
+				problems = append(problems, checkKeys(v, t.Elem(), prefix)...)
+			}
+		}
+		return problems
+	case reflect.Map:
+		if data.Kind == yaml.MappingNode && t.Elem() != reflect.TypeFor[search.Config]() {
+			for i := 0; i+1 < len(data.Content); i += 2 {
+				problems = append(problems, checkKeys(data.Content[i+1], t.Elem(), prefix+data.Content[i].Value+".")...)
+			}
+		}
+		return problems
+	case reflect.Struct:
+		// Checked below.
+	default:
+		return nil
+	}
+
+	if data.Kind != yaml.MappingNode {
+		// The decoder reports this.
+		return nil
+	}
+
+	for i := 0; i+1 < len(data.Content); i += 2 {
+		key, value := data.Content[i], data.Content[i+1]
+
+		f, ok := findField(t, key.Value)
+		if !ok {
+			problems = append(problems, &configError{key.Line, fmt.Errorf("unknown key %q", prefix+key.Value)})
+			continue
+		}
+
+		problems = append(problems, checkKeys(value, f.Type, prefix+key.Value+".")...)
+	}
+
+	return problems
+}
+
+// Finds the exported field of a struct that a key is decoded into.
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.IsExported() && yamlKey(f) == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Checks the configuration of an engine and initializes it.
+//
+// c is the loaded configuration, or nil if it failed to load.
+func checkEngine(c *config, key, value *yaml.Node) []error {
+	name := key.Value
+
+	var engCfg search.Config
+	if err := value.Decode(&engCfg); err != nil {
+		// The error from loadConfig already covers this.
+		return nil
+	}
+
+	typ := engCfg.Type
+	if typ == "" {
+		typ = name
+	}
+
+	if !slices.Contains(search.Supported(), typ) {
+		line := key.Line
+		if _, v := yamlLookup(value, "type"); v != nil {
+			line = v.Line
+		}
+		return []error{&configError{line, fmt.Errorf("engine %q: unknown engine type %q", name, typ)}}
+	}
+
+	// Mention what the engine does accept in case of a typo.
+	accepted := ""
+	if settings := search.SettingsOf(typ); len(settings) > 0 {
+		keys := make([]string, len(settings))
+		for i, v := range settings {
+			keys[i] = v.Key
+		}
+		accepted = fmt.Sprintf(" (%s accepts %s)", typ, strings.Join(keys, ", "))
+	}
+
+	var problems []error
+	engCfg.Name = name
+	for _, k := range engCfg.UnknownSettings() {
+		line := key.Line
+		if kn, _ := yamlLookup(value, k); kn != nil {
+			line = kn.Line
+		}
+		problems = append(problems, &configError{line, fmt.Errorf("engine %q: unknown key %q%s", name, k, accepted)})
+	}
+
+	if len(problems) == 0 {
+		if c != nil {
+			engCfg = c.engineConfig(name)
+		}
+
+		_, err := engCfg.New()
+
+		var serr *search.SettingError
+		switch {
+		case errors.As(err, &serr) && serr.Line > 0:
+			problems = append(problems, &configError{serr.Line, fmt.Errorf("engine %q: setting %q: %w", name, serr.Key, serr.Err)})
+		case err != nil:
+			problems = append(problems, &configError{key.Line, err})
+		}
+	}
+
+	return problems
+}
+
+// Checks a configuration file and prints every problem to w, prefixed by the
+// path and line.
+//
+// Returns the exit code of srchd -check.
+func runCheck(path string, w io.Writer) int {
+	problems := checkConfig(path)
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "%s: ok\n", path)
+		return 0
+	}
+
+	for _, err := range problems {
+		if cerr, ok := err.(*configError); ok {
+			fmt.Fprintf(w, "%s:%d: %v\n", path, cerr.Line, cerr.Err)
+		} else {
+			fmt.Fprintf(w, "%s: %v\n", path, err)
+		}
+	}
+
+	return 1
+}
+
+// Writes the engine-specific settings of every engine type in Markdown, as
+// found in docs/config.md.
+func writeEngineSettings(w io.Writer) {
+	types := slices.Clone(search.Supported())
+	slices.Sort(types)
+
+	for _, typ := range types {
+		settings := search.SettingsOf(typ)
+		if len(settings) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "**%s**:\n\n", typ)
+		for _, v := range settings {
+			fmt.Fprintf(w, "- `%s` (%s", v.Key, v.Type)
+			if v.Required {
+				fmt.Fprint(w, ", required")
+			}
+			if v.Default != "" {
+				fmt.Fprintf(w, ", default `%s`", v.Default)
+			}
+			fmt.Fprint(w, ")")
+			if v.Doc != "" {
+				fmt.Fprintf(w, ": %s", v.Doc)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		data string
+
+		// Each line must appear in the output, in order.
+		problems []string
+	}{
+		{"addr: :8080\nengines:\n  wiby:\n    weight: 2\n", nil},
+		{"addr: :8080\nwieght: 2\n", []string{`:2: unknown key "wieght"`}},
+		{"cache:\n  tll: 5m\n", []string{`:2: unknown key "cache.tll"`}},
+		{"rewrite:\n  - hostname: a.com\n    replce: b.com\n", []string{`:3: unknown key "rewrite.replce"`}},
+		{"rewrite:\n  - find: \"(\"\n    replace: x\n", []string{`:2: invalid regexp`}},
+		{"engines:\n  wiby:\n    wieght: 2\n", []string{`:3: engine "wiby": unknown key "wieght"`}},
+		{"engines:\n  foo:\n    type: nope\n", []string{`:3: engine "foo": unknown engine type "nope"`}},
+		{"engines:\n  wiki:\n    type: mediawiki\n", []string{`:2: engine "wiki": setting "endpoint": required but not set`}},
+		{"engines:\n  wiki:\n    type: mediawiki\n    endpoint: ftp://a.org\n", []string{`:4: engine "wiki": setting "endpoint": `}},
+		{"engines:\n  wiki:\n    type: mediawiki\n    endpont: x\n", []string{`:4: engine "wiki": unknown key "endpont" (mediawiki accepts endpoint)`}},
+		{"blacklists:\n  - missing.txt\n", []string{`:2: blacklist "missing.txt"`}},
+		{"disabled: [wiby, nope]\n", []string{`:1: disabled: unknown engine "nope"`}},
+		{"ranking: nope\nwieght: 2\n", []string{`: unknown ranking algorithm`, `:2: unknown key "wieght"`}},
+	}
+
+	for _, v := range tests {
+		path := writeTestConfig(t, t.TempDir(), v.data)
+
+		var out bytes.Buffer
+		code := runCheck(path, &out)
+
+		if len(v.problems) == 0 {
+			if code != 0 {
+				t.Errorf("config %q: unexpected problems:\n%s", v.data, out.String())
+			}
+			continue
+		}
+
+		if code == 0 {
+			t.Errorf("config %q: no problems found", v.data)
+			continue
+		}
+
+		rest := out.String()
+		for _, p := range v.problems {
+			p = filepath.Base(path) + p
+
+			i := strings.Index(rest, p)
+			if i < 0 {
+				t.Errorf("config %q: expected %q in output:\n%s", v.data, p, out.String())
+				break
+			}
+			rest = rest[i+len(p):]
+		}
+	}
+}
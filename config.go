@@ -2,13 +2,12 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
-	"sync"
+	"strings"
 	"time"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
@@ -38,23 +37,48 @@ type config struct {
 	//
 	// This will eventually provide more functionality, but works for my
 	// uses right now.
-	Rewrite []struct {
-		// Regular expression that matches against the link of a search
-		// result.
-		Regexp string `yaml:"find"`
-
-		// Matches an exact hostname.
-		Hostname string `yaml:"hostname"`
-
-		// Replace the affected part with this value.
-		//
-		// Using an empty string will outright delete the search
-		// result. (This specifically is deprecated and will be removed
-		// soon.)
-		ReplaceWith string `yaml:"replace"`
-
-		r *regexp.Regexp
-	}
+	Rewrite []rewriteRule
+
+	// Determines how results from several engines are ranked.
+	//
+	// The following algorithms are available:
+	//
+	//   - `votes`: results are ranked by the number of engines that
+	//     returned them, multiplied by the weight of those engines.
+	//   - `rrf`: Reciprocal Rank Fusion; results are also ranked by their
+	//     position in the results of each engine, so the first result of
+	//     an engine is worth more than its tenth.
+	//   - `interleave`: engines take turns placing their next result,
+	//     with engines of a higher weight getting more turns.
+	//
+	// Users can pick a different algorithm in their settings.
+	//
+	// The default is `votes`.
+	Ranking string `yaml:"ranking"`
+
+	// The k constant of Reciprocal Rank Fusion.
+	// Lower values give more importance to the top results of each engine.
+	//
+	// The default is 60.
+	RRFK float64 `yaml:"rrf_k"`
+
+	// Determines which links are considered to be the same when merging
+	// results and when checking blacklists.
+	//
+	// The links shown to users are never changed by this; see
+	// [canonicalizer] for the available rules.
+	// All rules are enabled by default.
+	Canonicalize canonicalizer `yaml:"canonicalize"`
+
+	// Results whose title and description are at least this similar are
+	// considered to be copies of the same page, such as mirrors, AMP
+	// pages or syndicated articles, and are shown as a single result.
+	//
+	// Similarity ranges from 0 to 1, where 1 means the text is identical.
+	// A value of 0 disables this.
+	//
+	// The default is 0.8.
+	NearDuplicateThreshold float64 `yaml:"near_duplicate_threshold"`
 
 	// Specifies a list of file paths containing uBlacklist blocklists.
 	// All file paths are relative to the configuration file directory.
@@ -66,6 +90,21 @@ type config struct {
 	// out search results.
 	Blacklists []string
 
+	// Maps bang triggers to the URL that they redirect to.
+	// A query containing "!trigger" is redirected to the URL instead of
+	// being searched, with `{{{s}}}` in the URL replaced by the rest of the
+	// query.
+	//
+	// For example, `w: https://en.wikipedia.org/w/index.php?search={{{s}}}`
+	// sends "!w golang" to Wikipedia.
+	// Bangs here take precedence over those in BangFiles.
+	Bangs map[string]string `yaml:"bangs"`
+
+	// Specifies a list of file paths containing bang lists in the format
+	// of DuckDuckGo's bang.json.
+	// All file paths are relative to the configuration file directory.
+	BangFiles []string `yaml:"bang_files"`
+
 	// Determines the interval to check the connection to certain engines.
 	// This uses Go's [time.Duration], so you can specify values like `5m`
 	// or `12h`.
@@ -73,6 +112,34 @@ type config struct {
 	// The default is `15m`.
 	PingInterval timeDuration `yaml:"ping_interval"`
 
+	// The maximum amount of time to wait for engines to respond to a
+	// search.
+	// Engines that take longer are reported as having timed out, and the
+	// results of all other engines are shown.
+	// If the cache is enabled, the results of late engines are still
+	// cached once they arrive.
+	//
+	// This can be overridden per search with the `timeout` parameter.
+	//
+	// The default is `0s`, which waits for all engines.
+	SearchDeadline timeDuration `yaml:"search_deadline"`
+
+	// The maximum amount of time to wait for running requests to finish
+	// when srchd is asked to stop with SIGINT or SIGTERM.
+	// Requests that are still running afterwards are canceled.
+	//
+	// The default is `10s`.
+	ShutdownTimeout timeDuration `yaml:"shutdown_timeout"`
+
+	// Configures when failing engines are suspended.
+	Breaker breakerConfig `yaml:"breaker"`
+
+	// Configures the in-memory cache of engine results.
+	//
+	// Results are cached per engine before blacklists and rewrite rules
+	// are applied, so changing either will still affect cached results.
+	Cache cacheConfig
+
 	// Specifies the default HTTP proxy.
 	// Overrides the HTTP_PROXY environment variable, but can be overridden
 	// by an engine's http_proxy setting.
@@ -84,6 +151,12 @@ type config struct {
 	// is set.
 	HttpProxy string `yaml:"http_proxy"`
 
+	// Configures the Prometheus metrics endpoint.
+	Metrics metricsConfig `yaml:"metrics"`
+
+	// Configures logging.
+	Log logConfig `yaml:"log"`
+
 	// pprof specifies an address to serve pprof on.
 	// It cannot listen on the same port as Addr.
 	//
@@ -100,6 +173,14 @@ type config struct {
 	// configuration.
 	Engines map[string]search.Config `yaml:"engines"`
 
+	// Named groups of engines.
+	// A group can be searched with the ":" operator just like an engine,
+	// e.g. ":smallweb", excluded with ":-smallweb", and picked in the
+	// settings.
+	//
+	// Group names must not be the same as the name of an engine.
+	Groups map[string][]string `yaml:"groups"`
+
 	// A list of engine names that should be explicitly disabled.
 	//
 	// Engines listed here will never be used at any point by srchd, even
@@ -107,6 +188,93 @@ type config struct {
 	Disabled []string `yaml:"disabled"`
 }
 
+// A rule to rewrite the links of results.
+type rewriteRule struct {
+	// Regular expression that matches against the link of a search
+	// result.
+	Regexp string `yaml:"find"`
+
+	// Matches an exact hostname.
+	Hostname string `yaml:"hostname"`
+
+	// Replace the affected part with this value.
+	//
+	// Using an empty string will outright delete the search
+	// result. (This specifically is deprecated and will be removed
+	// soon.)
+	ReplaceWith string `yaml:"replace"`
+
+	r *regexp.Regexp
+}
+
+// An error at a line of the configuration file.
+type configError struct {
+	Line int
+	Err  error
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *configError) Unwrap() error {
+	return e.Err
+}
+
+// Configuration of the result cache.
+type cacheConfig struct {
+	// Determines how long results are kept in the cache.
+	// This uses Go's [time.Duration].
+	//
+	// The default is `5m`; a value of `0s` disables the cache.
+	TTL timeDuration `yaml:"ttl"`
+
+	// The maximum number of entries to hold in the cache.
+	// An entry holds the results of one engine for one query and page.
+	//
+	// The default is 1000; a value of 0 disables the cache.
+	Size int `yaml:"size"`
+}
+
+// Configuration of the metrics endpoint.
+type metricsConfig struct {
+	// The path that metrics are served on, such as `/metrics`.
+	//
+	// The default is empty, which disables metrics, as they show how
+	// every engine is doing to anyone who can reach srchd.
+	Path string `yaml:"path"`
+
+	// Specifies an address to serve metrics on instead of Addr, so that
+	// they can be kept private.
+	//
+	// By default, this is blank and metrics are served on Addr.
+	Addr string `yaml:"addr"`
+}
+
+// Configuration of the circuit breaker of each engine.
+type breakerConfig struct {
+	// The number of consecutive errors after which an engine is
+	// suspended.
+	// Engines that return a captcha are suspended right away.
+	//
+	// The default is 5; a value of 0 never suspends engines.
+	Threshold int `yaml:"threshold"`
+
+	// Determines how long an engine is suspended for the first time.
+	// The backoff doubles every time the engine fails again after being
+	// brought back.
+	// This uses Go's [time.Duration].
+	//
+	// The default is `1m`.
+	Backoff timeDuration `yaml:"backoff"`
+
+	// The longest an engine is suspended for.
+	// This uses Go's [time.Duration].
+	//
+	// The default is `1h`.
+	MaxBackoff timeDuration `yaml:"max_backoff"`
+}
+
 // timeDuration is a wrapper on time.Duration which allows the decoding of
 // time.Duration values.
 type timeDuration struct {
@@ -118,34 +286,110 @@ var defaultConfig = config{
 	Addr:         ":8080",
 	BaseURL:      "http://localhost:8080",
 	PingInterval: timeDuration{time.Minute * 15},
+	Ranking:      rankVotes,
+	RRFK:         60,
+
+	NearDuplicateThreshold: 0.8,
+	ShutdownTimeout:        timeDuration{time.Second * 10},
+
+	Canonicalize: canonicalizer{
+		Scheme:          true,
+		WWW:             true,
+		TrailingSlash:   true,
+		DefaultPort:     true,
+		PercentEncoding: true,
+		IDN:             true,
+		SortQuery:       true,
+	},
+
+	Log: logConfig{
+		Level:         "info",
+		Format:        "text",
+		RedactQueries: true,
+	},
+
+	Breaker: breakerConfig{
+		Threshold:  5,
+		Backoff:    timeDuration{time.Minute},
+		MaxBackoff: timeDuration{time.Hour},
+	},
+
+	Cache: cacheConfig{
+		TTL:  timeDuration{time.Minute * 5},
+		Size: 1000,
+	},
 
 	Engines: map[string]search.Config{},
 }
 
-var cfg = defaultConfig
-
-func loadConfig(path string) error {
+// Reads and validates a configuration file.
+//
+// Values that are not set in the file are taken from [defaultConfig].
+func loadConfig(path string) (*config, error) {
 	h, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer h.Close()
 
+	cfg := defaultConfig
+	cfg.Engines = map[string]search.Config{}
+
 	if err := yaml.NewDecoder(h).Decode(&cfg); err != nil {
-		return err
+		return nil, err
+	}
+
+	if rankerByName(cfg.Ranking) == nil {
+		return nil, fmt.Errorf("unknown ranking algorithm %q", cfg.Ranking)
+	}
+
+	if cfg.RRFK < 0 {
+		return nil, fmt.Errorf("rrf_k must not be negative")
 	}
 
-	// Load all of the regexp rules
-	for i, v := range cfg.Rewrite {
-		if v.Regexp != "" && v.Hostname != "" {
-			return fmt.Errorf("regexp and hostname defined in rule")
+	if cfg.Metrics.Path != "" && !strings.HasPrefix(cfg.Metrics.Path, "/") {
+		return nil, fmt.Errorf("metrics path must start with /")
+	}
+
+	if err := cfg.Log.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.ShutdownTimeout.Duration < 0 {
+		return nil, fmt.Errorf("shutdown_timeout must not be negative")
+	}
+
+	if cfg.Breaker.Threshold < 0 {
+		return nil, fmt.Errorf("breaker threshold must not be negative")
+	}
+
+	if cfg.NearDuplicateThreshold > 1 {
+		return nil, fmt.Errorf("near_duplicate_threshold must be between 0 and 1")
+	}
+
+	for name, members := range cfg.Groups {
+		if _, ok := cfg.Engines[name]; ok || slices.Contains(search.Supported(), name) {
+			return nil, fmt.Errorf("group %q has the same name as an engine", name)
+		}
+
+		for _, v := range members {
+			if _, ok := cfg.Groups[v]; ok {
+				return nil, fmt.Errorf("group %q: groups cannot contain other groups", name)
+			}
+
+			if _, ok := cfg.Engines[v]; !ok && !slices.Contains(search.Supported(), v) {
+				return nil, fmt.Errorf("group %q: unknown engine %q", name, v)
+			}
 		}
+	}
 
-		if v.Hostname == "" {
-			v.r = regexp.MustCompile(v.Regexp)
-			cfg.Rewrite[i] = v
+	for trigger, link := range cfg.Bangs {
+		if err := validateBangURL(link); err != nil {
+			return nil, fmt.Errorf("bang %q: %w", trigger, err)
 		}
+	}
 
+	for _, v := range cfg.Rewrite {
 		// Notice for the empty ReplaceWith string being a deprecated
 		// method for blocking websites
 		if v.ReplaceWith == "" {
@@ -156,14 +400,14 @@ func loadConfig(path string) error {
 				rule = v.Hostname
 			}
 
-			log.Printf(`rewrite rule for %q: replace = "" is deprecated; use blacklists instead`, rule)
+			logMain.Warn(`replace = "" is deprecated; use blacklists instead`, "rule", rule)
 		}
 	}
 
 	// Rewrite all configuration file paths
 	configFileAbs, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path to configuration file: %w", err)
+		return nil, fmt.Errorf("failed to get absolute path to configuration file: %w", err)
 	}
 
 	configDir := filepath.Dir(configFileAbs)
@@ -177,7 +421,15 @@ func loadConfig(path string) error {
 		cfg.Blacklists[i] = filepath.Join(configDir, v)
 	}
 
-	return nil
+	for i, v := range cfg.BangFiles {
+		if filepath.IsAbs(v) {
+			continue
+		}
+
+		cfg.BangFiles[i] = filepath.Join(configDir, v)
+	}
+
+	return &cfg, nil
 }
 
 // Attempt to rewrite a URL.
@@ -186,7 +438,7 @@ func loadConfig(path string) error {
 func rewriteUrl(in string) string {
 	var parsedUrl *url.URL
 	var err error
-	for _, v := range cfg.Rewrite {
+	for _, v := range cfg().Rewrite {
 		if v.r != nil {
 			// v.r != nil when v.Hostname == ""
 
@@ -229,6 +481,52 @@ func rewriteUrl(in string) string {
 	return in
 }
 
+// Returns the key and value of a key of a YAML mapping, or nil if there is no
+// such key.
+func yamlLookup(data *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if data.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	for i := 0; i+1 < len(data.Content); i += 2 {
+		if data.Content[i].Value == key {
+			return data.Content[i], data.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// UnmarshalYAML parses a rewrite rule and compiles its regular expression.
+func (r *rewriteRule) UnmarshalYAML(data *yaml.Node) error {
+	// Lose the receiver functions to avoid recursion.
+	type _rewriteRule rewriteRule
+
+	var d _rewriteRule
+	if err := data.Decode(&d); err != nil {
+		return err
+	}
+
+	if d.Regexp != "" && d.Hostname != "" {
+		return &configError{data.Line, fmt.Errorf("regexp and hostname defined in rule")}
+	}
+
+	if d.Hostname == "" {
+		var err error
+		d.r, err = regexp.Compile(d.Regexp)
+		if err != nil {
+			line := data.Line
+			if _, v := yamlLookup(data, "find"); v != nil {
+				line = v.Line
+			}
+			return &configError{line, fmt.Errorf("invalid regexp: %w", err)}
+		}
+	}
+
+	*r = rewriteRule(d)
+	return nil
+}
+
 func (t *timeDuration) UnmarshalYAML(data *yaml.Node) error {
 	// This looks extremely weird, and I agree, but the point is that the
 	// line below checks to see if data is a string or not.
@@ -242,14 +540,14 @@ func (t *timeDuration) UnmarshalYAML(data *yaml.Node) error {
 	return err
 }
 
-// Attempts to initialize an engine.
+// Returns the configuration of an engine.
 //
 // Uses the engine's configuration as specified in the configuration, and also
 // merges in the default config.
-func initializeEngine(name string) (search.Engine, error) {
-	engCfg, ok := cfg.Engines[name]
-	if !ok {
-		// The map returns a zero-struct in this case so this is safe.
+func (c *config) engineConfig(name string) search.Config {
+	engCfg := c.Engines[name]
+	if engCfg.Type == "" {
+		// The engine is named after its type.
 		engCfg.Type = name
 	}
 	engCfg.Name = name
@@ -261,26 +559,35 @@ func initializeEngine(name string) (search.Engine, error) {
 	// sorta hacked in after the fact and when I redid the configuration
 	// system it was left out because I didn't have much of a use for it.
 	if engCfg.HttpProxy == "" {
-		engCfg.HttpProxy = cfg.HttpProxy
+		engCfg.HttpProxy = c.HttpProxy
 	}
 
-	return engCfg.New()
+	return engCfg
+}
+
+// Returns the type of an engine, which is its name unless configured
+// otherwise.
+func engineType(name string) string {
+	if engCfg, ok := cfg().Engines[name]; ok && engCfg.Type != "" {
+		return engCfg.Type
+	}
+	return name
 }
 
 // Determines if a specific engine has been disabled.
 //
 // An engine is disabled if it is explicitly disabled, or if it has no
 // configuration and is not an engine enabled by default.
-func engineIsDisabled(name string) bool {
+func (c *config) engineIsDisabled(name string) bool {
 	// Check if it is explicitly disabled first.
-	if slices.Contains(cfg.Disabled, name) {
+	if slices.Contains(c.Disabled, name) {
 		// Engine was disabled.
 		return true
 	}
 
 	// Not explicitly disabled.
 	// Check to see if it was configured.
-	_, ok := cfg.Engines[name]
+	_, ok := c.Engines[name]
 	if ok {
 		// Was configured.
 		return false
@@ -300,22 +607,22 @@ func engineIsDisabled(name string) bool {
 //
 // An enabled engine is one that is not explicitly disabled and is either set
 // to be a "default" engine or has been configured.
-var enabledEngines = sync.OnceValue(func() []string {
+func (c *config) enabledEngines() []string {
 	engines := make([]string, 0)
 
 	// Copy in all default engines provided they aren't disabled.
 	for _, v := range search.DefaultEngines() {
-		if !engineIsDisabled(v) {
+		if !c.engineIsDisabled(v) {
 			engines = append(engines, v)
 		}
 	}
 
 	// Copy in everything that was explicitly configured.
-	for k := range cfg.Engines {
-		if !engineIsDisabled(k) && !slices.Contains(engines, k) {
+	for k := range c.Engines {
+		if !c.engineIsDisabled(k) && !slices.Contains(engines, k) {
 			engines = append(engines, k)
 		}
 	}
 
 	return engines
-})
+}
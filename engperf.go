@@ -2,152 +2,186 @@ package main
 
 import (
 	"context"
-	"log"
-	"sync"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"time"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
 )
 
-var engineLatency = map[string]time.Duration{}
-var engineLatencyMu sync.RWMutex
-
-var engineResultCount = map[string]int{}
-var engineResultCountMu sync.RWMutex
-
-var engineDroppedCount = map[string]int{}
-var engineDroppedCountMu sync.RWMutex
+// Outcomes of requests to engines, as recorded by [engineRequests].
+//
+// Requests that fail with an HTTP status code are recorded as "http_" followed
+// by the code, e.g. "http_503".
+const (
+	outcomeSuccess     = "success"
+	outcomeCaptcha     = "captcha"
+	outcomeTimeout     = "timeout"
+	outcomeParseError  = "parse_error"
+	outcomeRateLimited = "rate_limited"
+	outcomeError       = "error"
+)
 
-var engineErrorCount = map[string]int{}
-var engineErrorCountMu sync.RWMutex
+// Engine metrics.
+var (
+	engineRequests = metrics.newCounter("srchd_engine_requests_total",
+		"Number of searches sent to an engine, by outcome.", "engine", "outcome")
+	engineDuration = metrics.newHistogram("srchd_engine_request_duration_seconds",
+		"Time taken by an engine to respond to a search.", engineDurationBuckets, "engine")
+	engineResults = metrics.newCounter("srchd_engine_results_total",
+		"Number of results returned by an engine.", "engine")
+	engineDropped = metrics.newCounter("srchd_engine_dropped_results_total",
+		"Number of results returned by an engine that were removed by the blacklist.", "engine")
+	engineCacheLookups = metrics.newCounter("srchd_engine_cache_lookups_total",
+		"Number of searches of an engine looked up in the result cache, by result.", "engine", "result")
+	engineCoalesced = metrics.newCounter("srchd_engine_coalesced_total",
+		"Number of searches of an engine that shared the request of an identical search.", "engine")
+	enginePing = metrics.newGauge("srchd_engine_ping_seconds",
+		"Time taken by the last successful ping of an engine, or 0 if it failed.", "engine")
+	engineUp = metrics.newGauge("srchd_engine_up",
+		"Whether the last ping of an engine succeeded.", "engine")
+)
 
-var engineReqTotalTime = map[string]time.Duration{}
-var engineReqTotalTimeMu sync.RWMutex
+// Frontend metrics.
+var (
+	frontendRequests = metrics.newCounter("srchd_http_requests_total",
+		"Number of HTTP requests served, by route and status code.", "route", "code")
+	frontendDuration = metrics.newHistogram("srchd_http_request_duration_seconds",
+		"Time taken to serve an HTTP request, by route.", frontendDurationBuckets, "route")
+)
 
-var engineReqCount = map[string]int{}
-var engineReqCountMu sync.RWMutex
+// Wakes up the pinger to ping all engines right away.
+var pingNow = make(chan struct{}, 1)
 
 // Ping loop.
 func pinger(ctx context.Context) {
-	ticker := time.NewTicker(cfg.PingInterval.Duration)
+	ticker := time.NewTicker(cfg().PingInterval.Duration)
 	defer ticker.Stop()
 
 	fn := func(name string, eng search.Engine) {
 		then := time.Now()
 		if err := eng.Ping(ctx); err != nil {
-			engineLatencyMu.Lock()
-			engineLatency[name] = 0
-			engineLatencyMu.Unlock()
+			enginePing.Set(0, name)
+			engineUp.Set(0, name)
 
-			log.Printf("pinging %s failed: %v", name, err)
+			logMain.Warn("ping failed", "engine", name, "err", err)
 			return
 		}
 
 		dur := time.Since(then).Truncate(time.Millisecond)
-		log.Printf("ping for %s took %v", name, dur)
+		logMain.Debug("ping succeeded", "engine", name, "duration", dur)
 
-		engineLatencyMu.Lock()
-		engineLatency[name] = dur
-		engineLatencyMu.Unlock()
+		enginePing.Set(dur.Seconds(), name)
+		engineUp.Set(1, name)
 	}
 
 	for {
-		for name, eng := range engines {
+		for name, eng := range current().engines {
 			go fn(name, eng)
 		}
 
 		select {
 		case <-ticker.C:
 			// This space is intentionally left blank.
+		case <-pingNow:
+			// The configuration was reloaded, which may have
+			// changed the interval.
+			ticker.Reset(cfg().PingInterval.Duration)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func getEngineLatency(name string) time.Duration {
-	engineLatencyMu.RLock()
-	defer engineLatencyMu.RUnlock()
+// Determines the outcome of a search from the error the engine returned.
+func requestOutcome(err error) string {
+	var httpErr search.HttpError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, search.ErrCaptcha):
+		return outcomeCaptcha
+	case errors.Is(err, search.ErrRateLimited):
+		return outcomeRateLimited
+	case errors.As(err, &httpErr):
+		return fmt.Sprintf("http_%d", httpErr.Status)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return outcomeTimeout
+	case errors.Is(err, search.ErrParse), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return outcomeParseError
+	default:
+		return outcomeError
+	}
+}
+
+// Records a search sent to an engine that returned a number of results.
+func recordEngineRequest(name string, d time.Duration, results int, err error) {
+	engineRequests.Inc(name, requestOutcome(err))
+	engineDuration.Observe(d.Seconds(), name)
+	getEngineWindow(name).record(time.Now(), d, results, err)
+}
 
-	return engineLatency[name]
+// Returns the health of the proxies of every engine that uses any.
+func engineProxyStats() map[string][]search.ProxyStat {
+	out := map[string][]search.ProxyStat{}
+	for name := range current().engines {
+		if stats := search.ProxyStats(name); len(stats) > 0 {
+			out[name] = stats
+		}
+	}
+	return out
 }
 
 // Returns the total number of results an engine has returned since srchd has
 // started.
 func getEngineResultCount(name string) int {
-	engineResultCountMu.RLock()
-	defer engineResultCountMu.RUnlock()
-
-	return engineResultCount[name]
+	return int(engineResults.Value(name))
 }
 
 // Returns the total number of dropped results an engine has returned since
 // srchd has started.
 func getEngineDroppedCount(name string) int {
-	engineDroppedCountMu.RLock()
-	defer engineDroppedCountMu.RUnlock()
-
-	return engineDroppedCount[name]
+	return int(engineDropped.Value(name))
 }
 
 // Returns the total number of errors an engine has returned since srchd has
 // started.
 func getEngineErrorCount(name string) int {
-	engineErrorCountMu.RLock()
-	defer engineErrorCountMu.RUnlock()
-
-	return engineErrorCount[name]
+	return int(engineRequests.Value(name) - engineRequests.Value(name, outcomeSuccess))
 }
 
 // Returns the average amount of time a search request takes to complete for a
 // specified engine.
 func getEngineAverageReqTime(name string) time.Duration {
-	engineReqTotalTimeMu.RLock()
-	defer engineReqTotalTimeMu.RUnlock()
-	engineReqCountMu.RLock()
-	defer engineReqCountMu.RUnlock()
-
-	if engineReqCount[name] == 0 {
+	n := engineDuration.Count(name)
+	if n == 0 {
 		return 0
 	}
 
-	return (engineReqTotalTime[name] / time.Duration(engineReqCount[name])).Truncate(time.Millisecond)
+	avg := engineDuration.Value(name) / float64(n)
+	return time.Duration(avg * float64(time.Second)).Truncate(time.Millisecond)
 }
 
-// Increments the number of results an engine has returned since srchd has
-// started.
-func addEngineResultCount(name string, count int) {
-	engineResultCountMu.Lock()
-	defer engineResultCountMu.Unlock()
-
-	engineResultCount[name] += count
+// Returns the number of searches for an engine that were answered from the
+// result cache since srchd has started.
+func getEngineCacheHitCount(name string) int {
+	return int(engineCacheLookups.Value(name, "hit"))
 }
 
-// Increments the number of dropped results an engine has returned since srchd
-// has started.
-func addEngineDroppedCount(name string, count int) {
-	engineDroppedCountMu.Lock()
-	defer engineDroppedCountMu.Unlock()
-
-	engineDroppedCount[name] += count
+// Returns the number of searches for an engine that were not in the result
+// cache since srchd has started.
+func getEngineCacheMissCount(name string) int {
+	return int(engineCacheLookups.Value(name, "miss"))
 }
 
-// Increments the total amount of time spent waiting for results from an engine.
-func recordEngineReqTime(name string, d time.Duration) {
-	engineReqTotalTimeMu.Lock()
-	defer engineReqTotalTimeMu.Unlock()
-	engineReqCountMu.Lock()
-	defer engineReqCountMu.Unlock()
-
-	engineReqTotalTime[name] += d
-	engineReqCount[name]++
-}
-
-// Increments the number of errors an engine has returned since srchd has
-// started by 1.
-func incrementEngineErrorCount(name string) {
-	engineErrorCountMu.Lock()
-	defer engineErrorCountMu.Unlock()
-
-	engineErrorCount[name]++
+// Returns the number of searches for an engine that shared the request of an
+// identical search running at the same time since srchd has started.
+func getEngineCoalescedCount(name string) int {
+	return int(engineCoalesced.Value(name))
 }
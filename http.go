@@ -4,10 +4,10 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
-	"log"
 	"net"
 	"net/http"
 	"slices"
@@ -19,19 +19,50 @@ import (
 )
 
 type tmplData struct {
-	Title   string
-	Query   string
-	Page    int
-	Results []search.Result
-	Errors  map[string]error
-	Error   error
-	BaseURL string
+	Title    string
+	Query    string
+	Page     int
+	Category search.Category
+	Results  []search.Result
+	Errors   map[string]error
+	Error    error
+	BaseURL  string
 }
 
 type confData struct {
 	tmplData
 	Engines  []string
+	Groups   []string
 	Selected []string
+	Stream   bool
+	Rankers  []string
+	Ranker   string
+	Options  search.Options
+
+	SafeSearchLevels []search.SafeSearch
+	TimeRanges       []search.TimeRange
+
+	// Proxies used by each engine, for engines that use any.
+	Proxies map[string][]search.ProxyStat
+}
+
+type bangData struct {
+	tmplData
+	Bangs []bang
+}
+
+// Information about an engine returned by /api/engines.
+type engineInfo struct {
+	Name         string              `json:"name"`
+	Type         string              `json:"type"`
+	Default      bool                `json:"default"`
+	Capabilities search.Capabilities `json:"capabilities"`
+}
+
+// Recent stats of an engine returned by /api/stats.
+type engineStats struct {
+	Name    string          `json:"name"`
+	Windows []windowSummary `json:"windows"`
 }
 
 type searchAPIResponse struct {
@@ -53,11 +84,23 @@ var tmpl = template.Must(template.New("").Funcs(template.FuncMap{
 		return x - 1
 	},
 	"strIn":              slices.Contains[[]string],
-	"engineLatency":      getEngineLatency,
 	"engineResultCount":  getEngineResultCount,
 	"engineDroppedCount": getEngineDroppedCount,
 	"engineErrorCount":   getEngineErrorCount,
 	"engineAvgReqTime":   getEngineAverageReqTime,
+	"engineCacheHits":    getEngineCacheHitCount,
+	"engineCacheMisses":  getEngineCacheMissCount,
+	"engineCoalesced":    getEngineCoalescedCount,
+	"engineWindows":      getEngineWindows,
+	"engineCapabilities": engineCapabilities,
+	"engineBreaker":      getEngineBreakerStatus,
+	"categories": func() []search.Category {
+		return search.Categories
+	},
+	"date": func(t *time.Time) string {
+		return t.Format("2 Jan 2006")
+	},
+	"clock": formatClock,
 	"version": func() string {
 		return Version
 	},
@@ -65,10 +108,162 @@ var tmpl = template.Must(template.New("").Funcs(template.FuncMap{
 
 func templateExecute(out io.Writer, name string, data any) {
 	if err := tmpl.ExecuteTemplate(out, name, data); err != nil {
-		log.Printf("executing template %q failed: %v", name, err)
+		logHTTP.Error("executing template failed", "template", name, "err", err)
+	}
+}
+
+// Formats a duration like a clock, e.g. "4:05" or "1:02:03".
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// Determines the name of the ranker to use for a request.
+//
+// The ranker can be set per request with the "ranker" parameter, or in the
+// settings; if neither is set or valid, the configured ranker is used.
+func findWantedRanker(r *http.Request) string {
+	name := r.FormValue("ranker")
+	if name == "" {
+		if cookie, err := r.Cookie("ranker"); err == nil {
+			name = cookie.Value
+		}
+	}
+
+	if !slices.Contains(rankerNames, name) {
+		return cfg().Ranking
+	}
+
+	return name
+}
+
+// Reads the search options saved in the settings.
+//
+// If any of them are invalid, all of them are ignored.
+func cookieSearchOptions(r *http.Request) search.Options {
+	get := func(name string) string {
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+
+	opts := search.Options{
+		Language:   get("lang"),
+		Region:     get("region"),
+		SafeSearch: search.SafeSearch(get("safe")),
+		TimeRange:  search.TimeRange(get("time")),
+	}.Normalize()
+
+	if opts.Validate() != nil {
+		return search.Options{}
+	}
+	return opts
+}
+
+// Determines the search options of a request.
+//
+// Each option can be set per request with a parameter of the same name as its
+// cookie, or in the settings.
+func findSearchOptions(r *http.Request) (search.Options, error) {
+	opts := cookieSearchOptions(r)
+
+	params := search.Options{
+		Language:   r.FormValue("lang"),
+		Region:     r.FormValue("region"),
+		SafeSearch: search.SafeSearch(r.FormValue("safe")),
+		TimeRange:  search.TimeRange(r.FormValue("time")),
+	}.Normalize()
+
+	if err := params.Validate(); err != nil {
+		return opts, err
+	}
+
+	// Parameters override the settings.
+	if params.Language != "" {
+		opts.Language = params.Language
+	}
+	if params.Region != "" {
+		opts.Region = params.Region
+	}
+	if params.SafeSearch != "" {
+		opts.SafeSearch = params.SafeSearch
+	}
+	if params.TimeRange != "" {
+		opts.TimeRange = params.TimeRange
+	}
+
+	return opts, nil
+}
+
+// Parses the parameters of a search request.
+func parseSearchParams(r *http.Request) (searchParams, error) {
+	params := searchParams{
+		Query:    r.FormValue("q"),
+		Category: search.CategoryWeb,
+		Timeout:  cfg().SearchDeadline.Duration,
+		Ranker:   rankerByName(findWantedRanker(r)),
+	}
+
+	var err error
+	params.Options, err = findSearchOptions(r)
+	if err != nil {
+		return params, err
+	}
+
+	if c := r.FormValue("c"); c != "" {
+		params.Category = search.Category(c)
+		if !slices.Contains(search.Categories, params.Category) {
+			return params, fmt.Errorf("unknown category %q", c)
+		}
+	}
+
+	// Only search the engines in the settings if the user picked any;
+	// otherwise, every enabled engine is searched.
+	if cookie, err := r.Cookie("engines"); err == nil && strings.TrimSpace(cookie.Value) != "" {
+		params.Engines = findWantedEngines(r)
+	}
+
+	// Only parse the page value if it isn't empty.
+	if page := r.FormValue("p"); page != "" {
+		params.Page, err = strconv.Atoi(page)
+		if err != nil {
+			return params, err
+		}
 	}
+
+	// The timeout may either be a duration ("1.5s") or a number of
+	// seconds ("1.5").
+	if timeout := r.FormValue("timeout"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			secs, ferr := strconv.ParseFloat(timeout, 64)
+			if ferr != nil {
+				return params, fmt.Errorf("invalid timeout %q", timeout)
+			}
+			d = time.Duration(secs * float64(time.Second))
+		}
+
+		if d < 0 || d > maxSearchTimeout {
+			return params, fmt.Errorf("invalid timeout %q", timeout)
+		}
+
+		params.Timeout = d
+	}
+
+	return params, nil
 }
 
+// The longest timeout that a search may ask for.
+//
+// This leaves time to write the partial results before the write timeout of
+// the server cuts the connection.
+const maxSearchTimeout = 10 * time.Second
+
 func httpSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet && r.Method != http.MethodPost {
 		// Unsupported method
@@ -77,27 +272,32 @@ func httpSearch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Grab and parse query parameters.
-	page := r.FormValue("p")
-	query := r.FormValue("q")
+	params, err := parseSearchParams(r)
+	if err != nil {
+		// TODO
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	var pageNo int
-	var err error
-	if page != "" {
-		// Only parse the page value if it isn't empty.
-		pageNo, err = strconv.Atoi(page)
-		if err != nil {
-			// TODO
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	// Send the user elsewhere if they used a bang.
+	if link, ok := current().bangs.Redirect(params.Query); ok {
+		http.Redirect(w, r, link, http.StatusFound)
+		return
 	}
 
 	// If requested, we can return results in JSON.
 	// There's a better way to check for this, but eh, whatever.
 	isAPI := r.Header.Get("Accept") == "application/json"
 
+	// Render the results as they come in if the user asked for it.
+	// The status code can't depend on the results in this case.
+	if !isAPI && wantsStreaming(r) {
+		httpSearchProgressive(w, r, params)
+		return
+	}
+
 	// Perform the search.
-	res, errors, err := doSearch(r, query, pageNo)
+	res, errors, err := doSearch(r.Context(), params)
 	if err != nil {
 		// Set a failure response code.
 		// Everything else is handled by the template.
@@ -122,24 +322,55 @@ func httpSearch(w http.ResponseWriter, r *http.Request) {
 
 	// Return the results using HTML.
 	templateExecute(w, "search.html", tmplData{
-		Title:   query,
-		Query:   query,
-		Page:    pageNo,
-		Results: res,
-		Errors:  errors,
-		Error:   err,
-		BaseURL: cfg.BaseURL,
+		Title:    params.Query,
+		Query:    params.Query,
+		Page:     params.Page,
+		Category: params.Category,
+		Results:  res,
+		Errors:   errors,
+		Error:    err,
+		BaseURL:  cfg().BaseURL,
 	})
 }
 
+// Stops a server from accepting connections and waits up to the shutdown
+// timeout for running requests to finish.
+//
+// If they don't, the server is closed, which cuts their connections, and the
+// error of [http.Server.Shutdown] is returned.
+func shutdownServer(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg().ShutdownTimeout.Duration)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return err
+	}
+	return nil
+}
+
 // Sets up a HTTP server from the current configuration.
 //
 // When the context that is passed to this function is canceled, the server
-// will be shutdown and the error will be [context.Canceled].
+// stops accepting connections and waits up to the shutdown timeout for running
+// requests to finish before canceling them.
+// serveHTTP then returns [context.Canceled].
 //
 // serveHTTP never returns a nil error.
 func serveHTTP(ctx context.Context) error {
-	ctx, cancel := context.WithCancel(ctx)
+	l, err := net.Listen("tcp", cfg().Addr)
+	if err != nil {
+		return err
+	}
+
+	return serveListener(ctx, l)
+}
+
+// Serves HTTP on a listener; see [serveHTTP].
+func serveListener(ctx context.Context, l net.Listener) error {
+	// Requests outlive ctx while the server drains, and are only canceled
+	// once the shutdown timeout is up.
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
 	defer cancel()
 
 	mux := http.NewServeMux()
@@ -147,10 +378,13 @@ func serveHTTP(ctx context.Context) error {
 	// search endpoint is the one most people will be hitting.
 	mux.HandleFunc("/search", httpSearch)
 
+	// Streams results using server-sent events as engines finish.
+	mux.HandleFunc("GET /search/stream", httpSearchStream)
+
 	// index
 	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		templateExecute(w, "index.html", tmplData{
-			BaseURL: cfg.BaseURL,
+			BaseURL: cfg().BaseURL,
 		})
 	})
 
@@ -159,7 +393,7 @@ func serveHTTP(ctx context.Context) error {
 	// BaseURL is configured correctly.
 	mux.HandleFunc("GET /opensearch.xml", func(w http.ResponseWriter, r *http.Request) {
 		templateExecute(w, "opensearch.xml", tmplData{
-			BaseURL: cfg.BaseURL,
+			BaseURL: cfg().BaseURL,
 		})
 	})
 
@@ -172,10 +406,18 @@ func serveHTTP(ctx context.Context) error {
 		templateExecute(w, "settings.html", confData{
 			tmplData: tmplData{
 				Title:   "Settings",
-				BaseURL: cfg.BaseURL,
+				BaseURL: cfg().BaseURL,
 			},
 			Engines:  enabledEngines(),
+			Groups:   groupNames(),
 			Selected: wanted,
+			Stream:   wantsStreaming(r),
+			Rankers:  rankerNames,
+			Ranker:   findWantedRanker(r),
+			Options:  cookieSearchOptions(r),
+
+			SafeSearchLevels: search.SafeSearchLevels,
+			TimeRanges:       search.TimeRanges,
 		})
 	})
 
@@ -200,17 +442,111 @@ func serveHTTP(ctx context.Context) error {
 			Value: strings.Join(wantedEngines, ","),
 		})
 
+		// The stream cookie determines if results are rendered as they
+		// come in.
+		stream := "0"
+		if r.FormValue("stream") == "1" {
+			stream = "1"
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:  "stream",
+			Value: stream,
+		})
+
+		// The ranker cookie determines how results are ranked.
+		if ranker := r.FormValue("ranker"); slices.Contains(rankerNames, ranker) {
+			http.SetCookie(w, &http.Cookie{
+				Name:  "ranker",
+				Value: ranker,
+			})
+		}
+
+		// The search options are each saved in their own cookie.
+		opts := search.Options{
+			Language:   r.FormValue("lang"),
+			Region:     r.FormValue("region"),
+			SafeSearch: search.SafeSearch(r.FormValue("safe")),
+			TimeRange:  search.TimeRange(r.FormValue("time")),
+		}.Normalize()
+
+		if err := opts.Validate(); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		for name, value := range map[string]string{
+			"lang":   opts.Language,
+			"region": opts.Region,
+			"safe":   string(opts.SafeSearch),
+			"time":   string(opts.TimeRange),
+		} {
+			http.SetCookie(w, &http.Cookie{
+				Name:  name,
+				Value: value,
+			})
+		}
+
 		http.Redirect(w, r, "/settings", http.StatusFound)
 	})
 
+	// list of bangs
+	mux.HandleFunc("GET /bangs", func(w http.ResponseWriter, r *http.Request) {
+		templateExecute(w, "bangs.html", bangData{
+			tmplData: tmplData{
+				Title:   "Bangs",
+				BaseURL: cfg().BaseURL,
+			},
+			Bangs: current().bangs.List(),
+		})
+	})
+
+	// engine capabilities
+	mux.HandleFunc("GET /api/engines", func(w http.ResponseWriter, r *http.Request) {
+		out := []engineInfo{}
+		for _, name := range enabledEngines() {
+			out = append(out, engineInfo{
+				Name:         name,
+				Type:         engineType(name),
+				Default:      slices.Contains(search.DefaultEngines(), name),
+				Capabilities: engineCapabilities(name),
+			})
+		}
+
+		slices.SortFunc(out, func(a, b engineInfo) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+
+	// recent engine stats, for graphing
+	mux.HandleFunc("GET /api/stats", func(w http.ResponseWriter, r *http.Request) {
+		out := []engineStats{}
+		for _, name := range enabledEngines() {
+			out = append(out, engineStats{
+				Name:    name,
+				Windows: getEngineWindows(name),
+			})
+		}
+
+		slices.SortFunc(out, func(a, b engineStats) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+
 	// engine stats
 	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
 		templateExecute(w, "stats.html", confData{
 			tmplData: tmplData{
 				Title:   "Stats",
-				BaseURL: cfg.BaseURL,
+				BaseURL: cfg().BaseURL,
 			},
 			Engines: enabledEngines(),
+			Proxies: engineProxyStats(),
 		})
 	})
 
@@ -223,10 +559,15 @@ func serveHTTP(ctx context.Context) error {
 	mux.Handle("/css/", fileServer)
 	mux.Handle("/robots.txt", fileServer)
 
+	// Metrics get their own listener if they should be kept private.
+	if cfg().Metrics.Path != "" && cfg().Metrics.Addr == "" {
+		mux.Handle("GET "+cfg().Metrics.Path, metrics)
+	}
+
 	// With the HTTP stuff dealt with, let's setup the server
 	srv := &http.Server{
-		Addr:    cfg.Addr,
-		Handler: mux,
+		Addr:    cfg().Addr,
+		Handler: instrumentHandler(mux),
 
 		// TODO: Should we allow these values to be tweaked from the
 		// config?
@@ -236,26 +577,43 @@ func serveHTTP(ctx context.Context) error {
 
 		// We want to use our own context
 		BaseContext: func(_ net.Listener) context.Context {
-			return ctx
+			return reqCtx
 		},
 	}
 
-	// Special goroutine to close the server when the context is canceled.
+	// Special goroutine to shut the server down when the context is
+	// canceled.
+	done := make(chan struct{})
 	go func() {
-		<-ctx.Done()
-		srv.Close()
+		defer close(done)
+
+		select {
+		case <-ctx.Done():
+		case <-reqCtx.Done():
+			// The server failed on its own.
+			return
+		}
+
+		logHTTP.Info("shutting down; waiting for running requests", "timeout", cfg().ShutdownTimeout.Duration)
+		if err := shutdownServer(srv); err != nil {
+			logHTTP.Warn("requests still running after the shutdown timeout; canceled them", "err", err)
+			cancel()
+		}
 	}()
 
-	log.Printf("listening on %s", cfg.Addr)
-	err = srv.ListenAndServe()
+	logHTTP.Info("listening", "addr", l.Addr().String())
+	err = srv.Serve(l)
 
 	if ctx.Err() != nil {
-		// If this is not nil, then the server was closed because the
-		// context was canceled.
-		// We can safely ignore the error from the server.
+		// If this is not nil, then the server was shut down because
+		// the context was canceled.
+		// We can safely ignore the error from the server, but we have
+		// to wait for the shutdown to finish.
+		<-done
 		return ctx.Err()
 	}
 
 	// Return the error from the server, which is always non-nil.
+	cancel()
 	return err
 }
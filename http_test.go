@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// Starts serving on a random port, with the given shutdown timeout.
+//
+// Returns the base URL and a channel that receives the error of the server.
+func startTestServer(t *testing.T, ctx context.Context, timeout time.Duration) (string, <-chan error) {
+	st := *current()
+	c := *st.cfg
+	c.ShutdownTimeout = timeDuration{timeout}
+	st.cfg = &c
+	st.cache = nil
+	setTestInstance(t, &st)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serveListener(ctx, l)
+	}()
+
+	return "http://" + l.Addr().String(), errc
+}
+
+// Waits until an engine has been searched.
+func waitForSearch(t *testing.T, eng *staticEngine) {
+	for range 100 {
+		if eng.calls.Load() > 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("engine was never searched")
+}
+
+func TestServeDrain(t *testing.T) {
+	eng := &staticEngine{
+		results: []search.Result{{Title: "a", Link: "https://a.example/", Sources: []string{"a"}}},
+		delay:   200 * time.Millisecond,
+	}
+	setTestEngines(t, map[string]search.Engine{"a": eng})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base, errc := startTestServer(t, ctx, 5*time.Second)
+
+	type response struct {
+		body string
+		err  error
+	}
+	respc := make(chan response, 1)
+	go func() {
+		res, err := http.Get(base + "/search/stream?q=test")
+		if err != nil {
+			respc <- response{err: err}
+			return
+		}
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		respc <- response{string(body), err}
+	}()
+
+	// Stop the server while the search is running.
+	waitForSearch(t, eng)
+	cancel()
+
+	resp := <-respc
+	if resp.err != nil {
+		t.Fatalf("running request failed: %v", resp.err)
+	}
+	if !strings.Contains(resp.body, "event: done") || strings.Contains(resp.body, `"error"`) {
+		t.Errorf("running request did not finish:\n%s", resp.body)
+	}
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("server did not stop")
+	}
+
+	if _, err := http.Get(base + "/"); err == nil {
+		t.Errorf("server still accepts connections after stopping")
+	}
+}
+
+func TestServeDrainTimeout(t *testing.T) {
+	eng := &staticEngine{delay: 10 * time.Second}
+	setTestEngines(t, map[string]search.Engine{"a": eng})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base, errc := startTestServer(t, ctx, 50*time.Millisecond)
+
+	go func() {
+		res, err := http.Get(base + "/search/stream?q=test")
+		if err == nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+	}()
+
+	waitForSearch(t, eng)
+	cancel()
+
+	// The search is canceled instead of keeping srchd from stopping.
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("server did not stop after the shutdown timeout")
+	}
+}
+
+func TestParseSearchTimeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		ok      bool
+	}{
+		{"1.5s", 1500 * time.Millisecond, true},
+		{"2", 2 * time.Second, true},
+		{"10s", maxSearchTimeout, true},
+		{"-1s", 0, false},
+		{"11s", 0, false},
+		{"60", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, v := range tests {
+		r := httptest.NewRequest("GET", "/search?q=test&timeout="+v.timeout, nil)
+		params, err := parseSearchParams(r)
+		if (err == nil) != v.ok {
+			t.Errorf("timeout %q: err = %v", v.timeout, err)
+		} else if v.ok && params.Timeout != v.want {
+			t.Errorf("timeout %q: got %v, want %v", v.timeout, params.Timeout, v.want)
+		}
+	}
+}
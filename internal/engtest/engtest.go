@@ -154,7 +154,7 @@ func (t *Tester) mockTestFn(query string) func(t *testing.T) {
 		}
 
 		// Perform the query.
-		res, err := eng.Search(context.TODO(), query, 0)
+		res, err := eng.Search(context.TODO(), query, 0, search.Options{})
 		if err != nil {
 			tt.Fatalf("query failed: %v", err)
 		}
@@ -185,7 +185,7 @@ func (t *Tester) updateTestFn(query string) func(tt *testing.T) {
 		}
 
 		// Perform the query.
-		res, err := eng.Search(context.TODO(), query, 0)
+		res, err := eng.Search(context.TODO(), query, 0, search.Options{})
 		if err != nil {
 			tt.Fatalf("query failed: %v", err)
 		} else if len(res) == 0 {
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync/atomic"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// Subsystems that can be given their own log level.
+const (
+	// Startup, configuration and the pinger.
+	subsystemMain = "main"
+
+	// Searches sent to engines by srchd.
+	subsystemSearch = "search"
+
+	// The web frontend and API.
+	subsystemHTTP = "http"
+
+	// Engines themselves and the requests they send.
+	subsystemEngines = "engines"
+)
+
+// logSubsystems holds all subsystems.
+var logSubsystems = []string{subsystemMain, subsystemSearch, subsystemHTTP, subsystemEngines}
+
+// Configuration of logging.
+type logConfig struct {
+	// The minimum level of messages that are logged: `debug`, `info`,
+	// `warn` or `error`.
+	//
+	// The default is `info`.
+	Level string `yaml:"level"`
+
+	// The format of log messages: `text` or `json`.
+	//
+	// The default is `text`.
+	Format string `yaml:"format"`
+
+	// Overrides the level of individual subsystems: `main`, `search`,
+	// `http` and `engines`.
+	Subsystems map[string]string `yaml:"subsystems"`
+
+	// Whether queries are removed from logged URLs and from errors.
+	//
+	// The default is true.
+	RedactQueries bool `yaml:"redact_queries"`
+}
+
+// The handler that every subsystem logs to.
+var logOutput atomic.Pointer[slog.Handler]
+
+// The level of each subsystem.
+var logLevels = map[string]*slog.LevelVar{}
+
+// Loggers of each subsystem.
+var (
+	logMain   = newSubsystemLogger(subsystemMain)
+	logSearch = newSubsystemLogger(subsystemSearch)
+	logHTTP   = newSubsystemLogger(subsystemHTTP)
+)
+
+func init() {
+	setLogOutput(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	search.SetLogger(newSubsystemLogger(subsystemEngines))
+
+	// Messages of the log package, such as those of net/http, are
+	// logged by the main subsystem.
+	slog.SetDefault(logMain)
+}
+
+// subsystemHandler filters messages by the level of a subsystem and passes the
+// rest on to the current output.
+//
+// The output can be changed at any time with [setLogOutput], including after
+// loggers have been created.
+type subsystemHandler struct {
+	level *slog.LevelVar
+
+	// Applied to the output in order, as given to WithAttrs and WithGroup.
+	wrap []func(slog.Handler) slog.Handler
+}
+
+// Creates the logger of a subsystem.
+func newSubsystemLogger(name string) *slog.Logger {
+	level := &slog.LevelVar{}
+	logLevels[name] = level
+
+	return slog.New(&subsystemHandler{level: level}).With("subsystem", name)
+}
+
+// Sets the handler that all subsystems log to.
+func setLogOutput(h slog.Handler) {
+	logOutput.Store(&h)
+}
+
+func (h *subsystemHandler) output() slog.Handler {
+	out := *logOutput.Load()
+	for _, f := range h.wrap {
+		out = f(out)
+	}
+	return out
+}
+
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.output().Handle(ctx, r)
+}
+
+func (h *subsystemHandler) with(f func(slog.Handler) slog.Handler) *subsystemHandler {
+	return &subsystemHandler{
+		level: h.level,
+		wrap:  append(slices.Clip(h.wrap), f),
+	}
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler {
+		return out.WithAttrs(attrs)
+	})
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler {
+		return out.WithGroup(name)
+	})
+}
+
+// Parses the name of a log level.
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// Validates the logging configuration.
+func (c logConfig) validate() error {
+	if _, err := parseLogLevel(c.Level); err != nil {
+		return err
+	}
+
+	if c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("unknown log format %q", c.Format)
+	}
+
+	for name, level := range c.Subsystems {
+		if !slices.Contains(logSubsystems, name) {
+			return fmt.Errorf("unknown log subsystem %q", name)
+		}
+
+		if _, err := parseLogLevel(level); err != nil {
+			return fmt.Errorf("log subsystem %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Configures logging, writing messages to w.
+//
+// c must have been validated.
+func setupLogging(c logConfig, w io.Writer) {
+	// Levels are filtered by each subsystem.
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var h slog.Handler
+	if c.Format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	setLogOutput(h)
+
+	level, _ := parseLogLevel(c.Level)
+	for name, v := range logLevels {
+		v.Set(level)
+		if s, ok := c.Subsystems[name]; ok {
+			l, _ := parseLogLevel(s)
+			v.Set(l)
+		}
+	}
+
+	search.SetRedactQueries(c.RedactQueries)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogConfigValidate(t *testing.T) {
+	tests := []struct {
+		c  logConfig
+		ok bool
+	}{
+		{defaultConfig.Log, true},
+		{logConfig{Level: "debug", Format: "json"}, true},
+		{logConfig{Level: "loud", Format: "text"}, false},
+		{logConfig{Level: "info", Format: "xml"}, false},
+		{logConfig{Level: "info", Format: "text", Subsystems: map[string]string{"engines": "debug"}}, true},
+		{logConfig{Level: "info", Format: "text", Subsystems: map[string]string{"nope": "debug"}}, false},
+		{logConfig{Level: "info", Format: "text", Subsystems: map[string]string{"http": "loud"}}, false},
+	}
+
+	for i, v := range tests {
+		if err := v.c.validate(); (err == nil) != v.ok {
+			t.Errorf("test %d: err = %v", i, err)
+		}
+	}
+}
+
+func TestLoggingSubsystems(t *testing.T) {
+	var buf bytes.Buffer
+	setupLogging(logConfig{
+		Level:      "warn",
+		Format:     "json",
+		Subsystems: map[string]string{subsystemSearch: "debug"},
+	}, &buf)
+	defer setupLogging(defaultConfig.Log, os.Stderr)
+
+	logHTTP.Info("hidden")
+	logSearch.Debug("shown", "engine", "test")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 message, got %q", buf.String())
+	}
+
+	var msg map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &msg); err != nil {
+		t.Fatalf("message is not JSON: %v", err)
+	}
+
+	if msg["msg"] != "shown" || msg["subsystem"] != subsystemSearch || msg["engine"] != "test" {
+		t.Errorf("unexpected message: %v", msg)
+	}
+}
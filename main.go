@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	_ "git.sr.ht/~cmcevoy/srchd/search/engines"
 	_ "net/http/pprof"
@@ -13,11 +16,13 @@ import (
 
 var (
 	configPath = flag.String("conf", "", "configuration file; ./config.yaml will be used if it exists")
+	checkOnly  = flag.Bool("check", false, "check the configuration file for problems and exit")
+	listOnly   = flag.Bool("settings", false, "list the settings of every engine in Markdown and exit")
 )
 
-var blacklist = newBlacklist()
-
 func main() {
+	flag.Parse()
+
 	if *configPath == "" {
 		// Try config.yaml
 		if _, err := os.Stat("./config.yaml"); err == nil {
@@ -25,42 +30,95 @@ func main() {
 		}
 	}
 
-	log.Printf("srchd %s", Version)
+	if *listOnly {
+		writeEngineSettings(os.Stdout)
+		return
+	}
 
-	if *configPath != "" {
-		if err := loadConfig(*configPath); err != nil {
-			log.Fatalf("failed to load config file: %v", err)
+	if *checkOnly {
+		if *configPath == "" {
+			fmt.Fprintln(os.Stderr, "no configuration file to check; use -conf")
+			os.Exit(2)
 		}
+		os.Exit(runCheck(*configPath, os.Stderr))
 	}
 
-	for _, v := range cfg.Blacklists {
-		n, err := blacklist.LoadFile(v)
+	c := cfg()
+	if *configPath != "" {
+		var err error
+		c, err = loadConfig(*configPath)
 		if err != nil {
-			// TODO: should this be fatal?
-			log.Printf("failed to load blacklist %q: %v", v, err)
-		} else {
-			log.Printf("loaded %d rules from %s", n, v)
+			fatal("failed to load config file", "err", err)
 		}
 	}
 
-	for _, v := range enabledEngines() {
-		log.Printf("initializing engine %q", v)
+	setupLogging(c.Log, os.Stderr)
+	logMain.Info("starting srchd", "version", Version)
 
-		eng, err := initializeEngine(v)
-		if err != nil {
-			panic(err)
-		}
-		engines[v] = eng
+	st, err := newInstance(c, nil)
+	if err != nil {
+		fatal("failed to start", "err", err)
 	}
+	running.Store(st)
+
+	// SIGINT and SIGTERM stop srchd gracefully; a second one stops it
+	// right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		watchReload(ctx, *configPath)
+	}()
+	go func() {
+		defer wg.Done()
+		pinger(ctx)
+	}()
 
-	go pinger(context.TODO())
+	if c.Metrics.Path != "" && c.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET "+c.Metrics.Path, metrics)
+		msrv := &http.Server{Addr: c.Metrics.Addr, Handler: mux}
 
-	if cfg.Pprof != "" {
+		go func() {
+			logMain.Info("serving metrics", "addr", c.Metrics.Addr)
+			if err := msrv.ListenAndServe(); err != http.ErrServerClosed {
+				logMain.Error("serving metrics failed", "err", err)
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			<-ctx.Done()
+			if err := shutdownServer(msrv); err != nil {
+				logMain.Warn("metrics requests still running after the shutdown timeout", "err", err)
+			}
+		}()
+	}
+
+	if c.Pprof != "" {
 		go func() {
 			// TODO: VERY TEMPORARY
-			log.Println(http.ListenAndServe(cfg.Pprof, nil))
+			logMain.Error("serving pprof failed", "err", http.ListenAndServe(c.Pprof, nil))
 		}()
 	}
 
-	log.Fatal(serveHTTP(context.TODO()))
+	if err := serveHTTP(ctx); ctx.Err() == nil {
+		fatal("serving failed", "err", err)
+	}
+
+	// srchd keeps no state on disk: the cache, stats and engine cookies
+	// live in memory, so there is nothing to flush.
+	wg.Wait()
+	logMain.Info("stopped srchd")
+}
+
+// Logs an error and exits.
+func fatal(msg string, args ...any) {
+	logMain.Error(msg, args...)
+	os.Exit(1)
 }
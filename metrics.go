@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of metrics, as named by the Prometheus text format.
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// metricFamily is a metric with a value for every combination of its labels.
+//
+// Counters and gauges hold a single value per series, while histograms count
+// observations in buckets.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// A single series of a [metricFamily].
+type metricSeries struct {
+	labels []string
+
+	// Value of counters and gauges, or the sum of the observations of
+	// histograms.
+	value float64
+
+	// Cumulative counts of histograms, one for each bucket.
+	counts []uint64
+	count  uint64
+}
+
+// metricRegistry holds all metrics exported by srchd.
+type metricRegistry struct {
+	mu       sync.Mutex
+	families []*metricFamily
+}
+
+// The registry of all metrics.
+var metrics = &metricRegistry{}
+
+// Buckets of request durations, in seconds.
+var (
+	engineDurationBuckets   = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	frontendDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Creates a new metric and adds it to the registry.
+//
+// The labels are given in order to every method of the metric.
+func (r *metricRegistry) newMetric(kind, name, help string, buckets []float64, labels ...string) *metricFamily {
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*metricSeries{},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families = append(r.families, f)
+	return f
+}
+
+// Creates a new counter.
+func (r *metricRegistry) newCounter(name, help string, labels ...string) *metricFamily {
+	return r.newMetric(metricCounter, name, help, nil, labels...)
+}
+
+// Creates a new gauge.
+func (r *metricRegistry) newGauge(name, help string, labels ...string) *metricFamily {
+	return r.newMetric(metricGauge, name, help, nil, labels...)
+}
+
+// Creates a new histogram with the given upper bounds of its buckets.
+func (r *metricRegistry) newHistogram(name, help string, buckets []float64, labels ...string) *metricFamily {
+	return r.newMetric(metricHistogram, name, help, buckets, labels...)
+}
+
+// Returns the series for a set of label values, creating it if needed.
+//
+// f.mu must be held.
+func (f *metricFamily) get(values []string) *metricSeries {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d labels, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labels: slices.Clone(values)}
+		if f.kind == metricHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Adds v to a counter or gauge.
+func (f *metricFamily) Add(v float64, labels ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.get(labels).value += v
+}
+
+// Adds 1 to a counter or gauge.
+func (f *metricFamily) Inc(labels ...string) {
+	f.Add(1, labels...)
+}
+
+// Sets the value of a gauge.
+func (f *metricFamily) Set(v float64, labels ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.get(labels).value = v
+}
+
+// Records an observation in a histogram.
+func (f *metricFamily) Observe(v float64, labels ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(labels)
+	for i, le := range f.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// Returns the value of a counter or gauge, or the sum of the observations of a
+// histogram.
+//
+// Labels that are left out match any value, so the values of all matching
+// series are added together.
+func (f *metricFamily) Value(labels ...string) float64 {
+	v, _ := f.total(labels)
+	return v
+}
+
+// Returns the number of observations of a histogram.
+//
+// Labels that are left out match any value, like [metricFamily.Value].
+func (f *metricFamily) Count(labels ...string) uint64 {
+	_, n := f.total(labels)
+	return n
+}
+
+// Adds together the values and counts of all series that match a prefix of
+// label values.
+func (f *metricFamily) total(prefix []string) (float64, uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var v float64
+	var n uint64
+	for _, s := range f.series {
+		if slices.Equal(s.labels[:len(prefix)], prefix) {
+			v += s.value
+			n += s.count
+		}
+	}
+	return v, n
+}
+
+// Escapes a label value for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Formats a set of labels, with an extra label if name is not empty.
+func formatLabels(names, values []string, name, value string) string {
+	if len(names) == 0 && name == "" {
+		return ""
+	}
+
+	parts := make([]string, 0, len(names)+1)
+	for i, v := range names {
+		parts = append(parts, v+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if name != "" {
+		parts = append(parts, name+`="`+value+`"`)
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Formats a value for the text format.
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Writes a metric in the Prometheus text format.
+func (f *metricFamily) write(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+
+		if f.kind != metricHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labels, "", ""), formatValue(s.value))
+			continue
+		}
+
+		for i, le := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labels, "le", formatValue(le)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.labels, "", ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.labels, "", ""), s.count)
+	}
+}
+
+// Writes all metrics in the Prometheus text format.
+func (r *metricRegistry) write(w io.Writer) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	slices.SortFunc(families, func(a, b *metricFamily) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Serves all metrics in the Prometheus text format.
+func (r *metricRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.write(w)
+}
+
+// An http.ResponseWriter that remembers the status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+// Unwrap allows http.ResponseController to reach the real writer, which is
+// needed to stream responses.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Wraps the frontend's handler to record metrics about every request.
+//
+// Requests are labeled with the pattern of the route that handled them, so
+// that queries never end up in metrics.
+func instrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		then := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "other"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		frontendRequests.Inc(route, strconv.Itoa(rec.status))
+		frontendDuration.Observe(time.Since(then).Seconds(), route)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	r := &metricRegistry{}
+	requests := r.newCounter("test_requests_total", "Requests.", "engine", "outcome")
+	duration := r.newHistogram("test_duration_seconds", "Duration.", []float64{0.5, 1}, "engine")
+
+	requests.Inc("a", "success")
+	requests.Add(2, "a", "captcha")
+	requests.Inc(`b"`, "success")
+	duration.Observe(0.25, "a")
+	duration.Observe(0.75, "a")
+
+	buf := &strings.Builder{}
+	r.write(buf)
+
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{engine="a",le="0.5"} 1
+test_duration_seconds_bucket{engine="a",le="1"} 2
+test_duration_seconds_bucket{engine="a",le="+Inf"} 2
+test_duration_seconds_sum{engine="a"} 1
+test_duration_seconds_count{engine="a"} 2
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{engine="a",outcome="captcha"} 2
+test_requests_total{engine="a",outcome="success"} 1
+test_requests_total{engine="b\"",outcome="success"} 1
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", buf, want)
+	}
+
+	if v := requests.Value("a"); v != 3 {
+		t.Errorf("requests for a = %v, want 3", v)
+	}
+}
+
+func TestRequestOutcome(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, outcomeSuccess},
+		{search.ErrCaptcha, outcomeCaptcha},
+		{fmt.Errorf("failed to perform request: %w", search.ErrRateLimited), outcomeRateLimited},
+		{search.HttpError{Status: 503}, "http_503"},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), outcomeTimeout},
+		{fmt.Errorf("%w: bad", search.ErrParse), outcomeParseError},
+		{json.Unmarshal([]byte("{"), &struct{}{}), outcomeParseError},
+		{errors.New("something else"), outcomeError},
+	}
+
+	for _, v := range tests {
+		if got := requestOutcome(v.err); got != v.want {
+			t.Errorf("requestOutcome(%v) = %q, want %q", v.err, got, v.want)
+		}
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	before := frontendRequests.Value("GET /test/{id}", "418")
+
+	h := instrumentHandler(mux)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/secret-query", nil))
+
+	// The route is recorded, never the path itself.
+	if n := frontendRequests.Value("GET /test/{id}", "418") - before; n != 1 {
+		t.Errorf("recorded %v requests, want 1", n)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// Parameters for near-duplicate detection.
+const (
+	// Number of words in a shingle.
+	shingleSize = 3
+
+	// Number of hash functions in a MinHash signature.
+	// More hashes give a better estimate at the cost of speed.
+	minhashSize = 128
+
+	// Results with fewer shingles than this are never considered to be
+	// near-duplicates; short texts are too similar to compare reliably.
+	minShingles = 4
+)
+
+// A MinHash signature of the text of a result.
+type minhash [minhashSize]uint64
+
+// Splits text into lowercase words, ignoring punctuation.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Hashes every run of shingleSize consecutive words in text.
+func shingles(text string) []uint64 {
+	w := words(text)
+	if len(w) < shingleSize {
+		return nil
+	}
+
+	out := make([]uint64, 0, len(w)-shingleSize+1)
+	for i := 0; i+shingleSize <= len(w); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(w[i:i+shingleSize], " ")))
+		out = append(out, h.Sum64())
+	}
+
+	return out
+}
+
+// Mixes the bits of x; this is the finalizer of splitmix64.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Computes the MinHash signature of a set of shingles.
+//
+// Each hash function is the shingle hash mixed with a different seed.
+func newMinhash(shingles []uint64) minhash {
+	var sig minhash
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+
+	for _, sh := range shingles {
+		for i := range sig {
+			if h := mix(sh ^ mix(uint64(i)+1)); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+
+	return sig
+}
+
+// Estimates the Jaccard similarity of the texts that produced both
+// signatures.
+func (m *minhash) similarity(o *minhash) float64 {
+	same := 0
+	for i := range m {
+		if m[i] == o[i] {
+			same++
+		}
+	}
+	return float64(same) / minhashSize
+}
+
+// Collapses results with a similar title and description into one.
+//
+// Results are expected to be sorted; when two results are near-duplicates,
+// the later one is merged into the earlier one and its link is added to the
+// earlier one's Alternates.
+// A threshold of 0 or less disables this entirely.
+//
+// The returned slice shares memory with res.
+func collapseNearDuplicates(res []search.Result, threshold float64) []search.Result {
+	if threshold <= 0 {
+		return res
+	}
+
+	// Signatures of kept results, if they have enough text.
+	sigs := make([]*minhash, 0, len(res))
+	out := res[:0]
+
+outer:
+	for _, v := range res {
+		var sig *minhash
+		if sh := shingles(v.Title + " " + v.Description); len(sh) >= minShingles {
+			m := newMinhash(sh)
+			sig = &m
+		}
+
+		if sig != nil {
+			for i, other := range sigs {
+				if other == nil || sig.similarity(other) < threshold {
+					continue
+				}
+
+				mergeResult(&out[i], v)
+				out[i].Alternates = append(out[i].Alternates, v.Link)
+				out[i].Alternates = append(out[i].Alternates, v.Alternates...)
+				continue outer
+			}
+		}
+
+		sigs = append(sigs, sig)
+		out = append(out, v)
+	}
+
+	return out
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+func TestCollapseNearDuplicates(t *testing.T) {
+	res := []search.Result{
+		{
+			Title:       "How to bake sourdough bread at home",
+			Description: "A step by step guide to baking a crusty sourdough loaf with nothing but flour, water and salt.",
+			Link:        "https://example.com/sourdough",
+			Sources:     []string{"a"},
+		},
+		{
+			Title:       "Something else entirely",
+			Description: "This article is about a completely unrelated topic and shares no text with the others.",
+			Link:        "https://other.example/",
+			Sources:     []string{"a"},
+		},
+		{
+			Title:       "How to bake sourdough bread at home",
+			Description: "A step by step guide to baking a crusty sourdough loaf with nothing but flour, water and salt!",
+			Link:        "https://m.example.com/sourdough",
+			Sources:     []string{"b"},
+		},
+		{
+			// Too short to compare.
+			Title: "Home",
+			Link:  "https://a.example/",
+		},
+		{
+			Title: "Home",
+			Link:  "https://b.example/",
+		},
+	}
+
+	out := collapseNearDuplicates(res, 0.8)
+
+	if len(out) != 4 {
+		t.Fatalf("expected 4 results, got %d: %+v", len(out), out)
+	}
+
+	if out[0].Link != "https://example.com/sourdough" {
+		t.Errorf("expected first result to be kept, got %q", out[0].Link)
+	}
+
+	if len(out[0].Alternates) != 1 || out[0].Alternates[0] != "https://m.example.com/sourdough" {
+		t.Errorf("expected alternate link, got %v", out[0].Alternates)
+	}
+
+	if len(out[0].Sources) != 2 {
+		t.Errorf("expected sources to be merged, got %v", out[0].Sources)
+	}
+}
+
+func TestCollapseNearDuplicatesDisabled(t *testing.T) {
+	res := []search.Result{
+		{Title: "How to bake sourdough bread at home", Link: "https://example.com/"},
+		{Title: "How to bake sourdough bread at home", Link: "https://m.example.com/"},
+	}
+
+	if out := collapseNearDuplicates(res, 0); len(out) != 2 {
+		t.Errorf("expected 2 results, got %d", len(out))
+	}
+}
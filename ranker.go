@@ -0,0 +1,234 @@
+package main
+
+import (
+	"slices"
+	"sort"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// A Ranker merges the results of several engines into a single list.
+type Ranker interface {
+	// Rank merges the results of each engine, keyed by the name of the
+	// engine, into a single sorted list without duplicates.
+	//
+	// The results of an engine are in the order the engine returned them.
+	// Results are duplicates if [canonicalLink] returns the same link for
+	// both.
+	// Rank may modify the slices that it is given.
+	Rank(results map[string][]search.Result) []search.Result
+}
+
+// Names of the built-in rankers.
+const (
+	rankVotes      = "votes"
+	rankRRF        = "rrf"
+	rankInterleave = "interleave"
+)
+
+// Names of all built-in rankers, in the order they are shown in the settings.
+var rankerNames = []string{rankVotes, rankRRF, rankInterleave}
+
+// Ranks results by the number of engines that returned them, multiplied by
+// the weight of those engines.
+//
+// The position of a result in the results of an engine is not taken into
+// account other than to break ties.
+type voteRanker struct{}
+
+// Ranks results using Reciprocal Rank Fusion.
+//
+// Every engine that returned a result adds weight / (k + rank) to its score,
+// so results near the top of an engine's results are worth more than those
+// near the bottom.
+// See https://plg.uwaterloo.ca/~gvcormac/cormacksigir09-rrf.pdf
+type rrfRanker struct {
+	k float64
+}
+
+// Interleaves the results of all engines using weighted round-robin.
+//
+// Engines take turns placing their next result, with engines of a higher
+// weight getting more turns.
+// An engine's own ordering is always kept.
+type interleaveRanker struct{}
+
+var (
+	_ Ranker = voteRanker{}
+	_ Ranker = rrfRanker{}
+	_ Ranker = interleaveRanker{}
+)
+
+// Returns the built-in ranker with the specified name, or nil if there is no
+// such ranker.
+func rankerByName(name string) Ranker {
+	switch name {
+	case rankVotes:
+		return voteRanker{}
+	case rankRRF:
+		return rrfRanker{k: cfg().RRFK}
+	case rankInterleave:
+		return interleaveRanker{}
+	default:
+		return nil
+	}
+}
+
+// Returns the names of all engines in results in a stable order.
+func sortedEngineNames(results map[string][]search.Result) []string {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Merges src into dst, which is a result with the same canonical link.
+func mergeResult(dst *search.Result, src search.Result) {
+	// Add in the engine source(s).
+	// Technically there's only supposed to be one, so this may be unnecessary.
+	for _, name := range src.Sources {
+		if !slices.Contains(dst.Sources, name) {
+			dst.Sources = append(dst.Sources, name)
+		}
+	}
+
+	// If we're missing text, replace it with this.
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Description == "" {
+		dst.Description = src.Description
+	}
+
+	// Keep the best rank.
+	if src.Rank > 0 && (dst.Rank == 0 || src.Rank < dst.Rank) {
+		dst.Rank = src.Rank
+	}
+}
+
+// Merges duplicate results of all engines.
+//
+// score is called for each result returned by an engine and its return value
+// is added to the score of the merged result.
+// The merged results are returned in the order they were first seen.
+func mergeResults(results map[string][]search.Result, score func(res search.Result) float64) []search.Result {
+	// Track the first time we see a link.
+	firstSeen := map[string]int{}
+	out := []search.Result{}
+
+	for _, name := range sortedEngineNames(results) {
+		for _, v := range results[name] {
+			key := canonicalLink(v.Link)
+
+			idx, ok := firstSeen[key]
+			if !ok {
+				// First occurrence.
+				firstSeen[key] = len(out)
+				v.Score = score(v)
+				out = append(out, v)
+				continue
+			}
+
+			mergeResult(&out[idx], v)
+			out[idx].Score += score(v)
+		}
+	}
+
+	return out
+}
+
+// Sorts results in descending order of key.
+// Ties are broken by the best rank any engine gave the result.
+func sortResults(res []search.Result, key func(res search.Result) float64) {
+	sort.SliceStable(res, func(i, j int) bool {
+		ki, kj := key(res[i]), key(res[j])
+		if ki != kj {
+			// > is used so the results are descending and not
+			// ascending.
+			return ki > kj
+		}
+
+		return res[i].Rank < res[j].Rank
+	})
+}
+
+// Rank implements [Ranker].
+func (voteRanker) Rank(results map[string][]search.Result) []search.Result {
+	// Results seen several times will appear higher in the search
+	// results.
+	out := mergeResults(results, func(search.Result) float64 {
+		return 1
+	})
+
+	sortResults(out, func(res search.Result) float64 {
+		return calculateWeight(res) * res.Score
+	})
+
+	return out
+}
+
+// Rank implements [Ranker].
+func (r rrfRanker) Rank(results map[string][]search.Result) []search.Result {
+	out := mergeResults(results, func(res search.Result) float64 {
+		return calculateWeight(res) / (r.k + float64(res.Rank))
+	})
+
+	// The weight is already a part of the score.
+	sortResults(out, func(res search.Result) float64 {
+		return res.Score
+	})
+
+	return out
+}
+
+// Rank implements [Ranker].
+func (interleaveRanker) Rank(results map[string][]search.Result) []search.Result {
+	names := sortedEngineNames(results)
+
+	// Smooth weighted round-robin; every turn, each engine gains its
+	// weight in credit and the engine with the most credit goes next, at
+	// the cost of the total weight of all engines.
+	credit := make([]float64, len(names))
+
+	firstSeen := map[string]int{}
+	out := []search.Result{}
+
+	for {
+		next := -1
+		total := 0.0
+		for i, name := range names {
+			if len(results[name]) == 0 {
+				// This engine has no more results.
+				continue
+			}
+
+			credit[i] += engineWeight(name)
+			total += engineWeight(name)
+			if next == -1 || credit[i] > credit[next] {
+				next = i
+			}
+		}
+
+		if next == -1 {
+			// Everything has been placed.
+			return out
+		}
+
+		credit[next] -= total
+
+		name := names[next]
+		v := results[name][0]
+		results[name] = results[name][1:]
+
+		key := canonicalLink(v.Link)
+		if idx, ok := firstSeen[key]; ok {
+			mergeResult(&out[idx], v)
+			continue
+		}
+
+		firstSeen[key] = len(out)
+		out = append(out, v)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// instance holds the configuration and everything that srchd builds from it.
+//
+// An instance is never modified once it is running; reloading the
+// configuration builds a new instance and swaps it in as a whole.
+// Searches hold on to the instance they started with, so they finish with the
+// engines and blacklist they started with.
+type instance struct {
+	cfg *config
+
+	// Engines by name, and the names of all enabled engines.
+	engines map[string]search.Engine
+	enabled []string
+
+	blacklist *Blacklist
+	bangs     *bangList
+	cache     *resultCache
+}
+
+// The running instance.
+var running atomic.Pointer[instance]
+
+// Serializes reloads.
+var reloadMu sync.Mutex
+
+func init() {
+	c := defaultConfig
+	c.Engines = map[string]search.Config{}
+
+	running.Store(&instance{
+		cfg:       &c,
+		engines:   map[string]search.Engine{},
+		blacklist: newBlacklist(),
+		bangs:     newBangList(),
+	})
+}
+
+// Returns the running instance.
+func current() *instance {
+	return running.Load()
+}
+
+// Returns the running configuration.
+func cfg() *config {
+	return current().cfg
+}
+
+// Returns the names of all enabled engines.
+//
+// An enabled engine is one that is not explicitly disabled and is either set
+// to be a "default" engine or has been configured.
+func enabledEngines() []string {
+	return current().enabled
+}
+
+// Builds an instance from a configuration.
+//
+// Engines of prev whose configuration did not change are reused, so that
+// they keep their connections, proxy health and rate limits; so is the cache,
+// unless its configuration changed.
+// prev may be nil.
+func newInstance(c *config, prev *instance) (*instance, error) {
+	st := &instance{
+		cfg:       c,
+		engines:   map[string]search.Engine{},
+		enabled:   c.enabledEngines(),
+		blacklist: newBlacklist(),
+		bangs:     newBangList(),
+	}
+
+	for _, v := range st.enabled {
+		engCfg := c.engineConfig(v)
+
+		if prev != nil {
+			if eng, ok := prev.engines[v]; ok && prev.cfg.engineConfig(v).Equal(engCfg) {
+				st.engines[v] = eng
+				continue
+			}
+		}
+
+		logMain.Info("initializing engine", "engine", v)
+
+		eng, err := engCfg.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize engine %q: %w", v, err)
+		}
+		st.engines[v] = eng
+	}
+
+	for _, v := range c.Blacklists {
+		n, err := st.blacklist.LoadFile(v)
+		if err != nil {
+			// TODO: should this be fatal?
+			logMain.Error("failed to load blacklist", "path", v, "err", err)
+		} else {
+			logMain.Info("loaded blacklist", "path", v, "rules", n)
+		}
+	}
+
+	for _, v := range c.BangFiles {
+		n, err := st.bangs.LoadFile(v)
+		if err != nil {
+			logMain.Error("failed to load bangs", "path", v, "err", err)
+		} else {
+			logMain.Info("loaded bangs", "path", v, "bangs", n)
+		}
+	}
+
+	// Configured bangs override those loaded from files.
+	for trigger, link := range c.Bangs {
+		if err := st.bangs.Add(trigger, "", link); err != nil {
+			// Already validated by loadConfig.
+			logMain.Error("failed to add bang", "trigger", trigger, "err", err)
+		}
+	}
+
+	if prev != nil && prev.cfg.Cache == c.Cache {
+		st.cache = prev.cache
+	} else {
+		st.cache = newResultCache(c.Cache.Size, c.Cache.TTL.Duration)
+	}
+
+	return st, nil
+}
+
+// Reads the configuration file again and swaps in a new instance built from
+// it.
+//
+// If the configuration is invalid or an engine fails to initialize, the
+// running instance is kept and the error is returned.
+// Searches that are running when the new instance is swapped in are not
+// affected.
+func reloadConfig(path string) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	c, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	prev := current()
+	st, err := newInstance(c, prev)
+	if err != nil {
+		return err
+	}
+
+	// Some settings only take effect at startup.
+	if c.Addr != prev.cfg.Addr || c.Pprof != prev.cfg.Pprof || c.Metrics != prev.cfg.Metrics {
+		logMain.Warn("changes to addr, pprof and metrics require a restart")
+	}
+
+	setupLogging(c.Log, os.Stderr)
+
+	// Engines that were rebuilt start over with a clean slate, as do all
+	// engines if the breaker settings changed.
+	breakersMu.Lock()
+	for name := range breakers {
+		if prev.cfg.Breaker != c.Breaker || !prev.cfg.engineConfig(name).Equal(c.engineConfig(name)) {
+			delete(breakers, name)
+		}
+	}
+	breakersMu.Unlock()
+
+	running.Store(st)
+
+	// Ping the new engines right away rather than at the next interval.
+	select {
+	case pingNow <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Reloads the configuration file whenever srchd receives SIGHUP, until ctx is
+// canceled.
+func watchReload(ctx context.Context, path string) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return
+		}
+
+		if path == "" {
+			logMain.Warn("received SIGHUP, but there is no configuration file to reload")
+			continue
+		}
+
+		logMain.Info("reloading configuration", "path", path)
+		if err := reloadConfig(path); err != nil {
+			logMain.Error("failed to reload configuration; keeping the running one", "err", err)
+			continue
+		}
+		logMain.Info("reloaded configuration")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Writes a configuration file to a temporary directory.
+func writeTestConfig(t *testing.T, dir, data string) string {
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, `
+engines:
+  bing:
+    weight: 2
+  wiby:
+    timeout: 5s
+disabled: [brave, ddg, google, marginalia, yahoo]
+`)
+
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	st, err := newInstance(c, nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	setTestInstance(t, st)
+
+	writeTestConfig(t, dir, `
+engines:
+  bing:
+    weight: 3
+  wiby:
+    timeout: 10s
+  yandex: {}
+disabled: [brave, ddg, google, marginalia, yahoo]
+ranking: rrf
+`)
+
+	if err := reloadConfig(path); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+
+	next := current()
+	if next == st {
+		t.Fatal("instance was not replaced")
+	}
+
+	if next.cfg.Ranking != rankRRF || engineWeight("bing") != 3 {
+		t.Errorf("configuration was not replaced")
+	}
+
+	if next.engines["bing"] != st.engines["bing"] {
+		t.Errorf("engine with only a new weight was rebuilt")
+	}
+	if next.engines["wiby"] == st.engines["wiby"] {
+		t.Errorf("engine with a new configuration was not rebuilt")
+	}
+	if next.engines["yandex"] == nil || !slices.Contains(enabledEngines(), "yandex") {
+		t.Errorf("new engine was not added")
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "ranking: votes\n")
+
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	st, err := newInstance(c, nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	setTestInstance(t, st)
+
+	for _, v := range []string{
+		"ranking: nope\n",
+		"engines: [\n",
+		"engines:\n  nope: {}\n",
+	} {
+		writeTestConfig(t, dir, v)
+
+		if err := reloadConfig(path); err == nil {
+			t.Errorf("reloading %q succeeded", v)
+		}
+
+		if current() != st {
+			t.Errorf("reloading %q replaced the running instance", v)
+		}
+	}
+}
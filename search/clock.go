@@ -0,0 +1,29 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseClock parses a duration written like a clock, such as "4:05" or
+// "1:02:03", as is commonly done for the length of videos.
+func ParseClock(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid clock duration %q", s)
+	}
+
+	var d time.Duration
+	for _, v := range parts {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid clock duration %q", s)
+		}
+
+		d = d*60 + time.Duration(n)
+	}
+
+	return d * time.Second, nil
+}
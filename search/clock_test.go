@@ -0,0 +1,29 @@
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in  string
+		out time.Duration
+	}{
+		{"4:05", 4*time.Minute + 5*time.Second},
+		{" 0:59 ", 59 * time.Second},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"123", 0},
+		{"a:bc", 0},
+		{"1:2:3:4", 0},
+	}
+
+	for _, v := range tests {
+		t.Run(v.in, func(t *testing.T) {
+			res, err := ParseClock(v.in)
+			if (err != nil) != (v.out == 0) || res != v.out {
+				t.Errorf("%v != %v (err = %v)", res, v.out, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,10 @@ package search
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -78,6 +82,49 @@ type Config struct {
 	// of what HTTP_PROXY is set to.
 	HttpProxy string `yaml:"http_proxy"`
 
+	// Configures several HTTP proxies to spread requests across.
+	// Overrides HttpProxy.
+	HttpProxies []string `yaml:"http_proxies"`
+
+	// Determines which proxy of HttpProxies a request is sent through;
+	// see [ProxyStrategies].
+	//
+	// If this value is not set, [ProxyRoundRobin] is used.
+	ProxyStrategy ProxyStrategy `yaml:"proxy_strategy"`
+
+	// Proxies that get a captcha or a 429 status code from the engine are
+	// not used for this long, unless all proxies are benched.
+	//
+	// If set to 0, then [DefaultProxyBench] is used.
+	ProxyBench stringDuration `yaml:"proxy_bench"`
+
+	// Authenticate to SOCKS proxies with the name of the engine, so that
+	// proxies that support stream isolation such as Tor send the requests
+	// of each engine through their own circuits.
+	// Proxy URLs that have a username are left as-is.
+	ProxyIsolation bool `yaml:"proxy_isolation"`
+
+	// Limits the number of searches sent to the engine per minute.
+	// Pings and the extra requests that a search may need don't count.
+	// Searches over the limit fail with [ErrRateLimited] right away
+	// instead of waiting.
+	//
+	// If set to 0, the rate is not limited.
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+
+	// The number of searches that can be sent at once before
+	// RequestsPerMinute applies.
+	//
+	// If set to 0, then 1 is used.
+	Burst int `yaml:"burst"`
+
+	// Limits the number of searches sent to the engine per day, resetting
+	// at midnight UTC.
+	// Searches over the budget fail with [ErrRateLimited].
+	//
+	// If set to 0, there is no budget.
+	DailyBudget int `yaml:"daily_budget"`
+
 	// Enable HTTP/3 using quic-go.
 	QUIC bool `yaml:"quic"`
 
@@ -103,6 +150,13 @@ type Config struct {
 	// Refer to your [Engine] for possible/necessary configuration values.
 	Extra map[string]any `yaml:"-"`
 
+	// Settings holds the engine-specific settings decoded from Extra by
+	// [Config.New], as a pointer to the struct the engine declared in
+	// [Capabilities.Settings].
+	//
+	// It is nil if the engine declares no settings.
+	Settings any `yaml:"-"`
+
 	// Provide an existing HTTP client instead of creating one from the
 	// settings; it is recommended that you still create it using
 	// NewHttpClient, but if this field is filled then NewHttpClient will
@@ -111,6 +165,9 @@ type Config struct {
 	// This field exists primarily for mocking HTTP responses when
 	// performing testing.
 	HttpClient *HttpClient `yaml:"-"`
+
+	// The node the configuration was decoded from, if any.
+	node *yaml.Node
 }
 
 // Wrapper struct to allow decoding time.Duration string values (such as "5s"
@@ -125,13 +182,17 @@ type stringDuration struct {
 // Default timeout setting.
 const DefaultTimeout = time.Second * 10
 
+// Returns the type of the engine, falling back to its name.
+func (c Config) driverType() string {
+	if c.Type == "" {
+		return c.Name
+	}
+	return c.Type
+}
+
 // Initializes the specified from struct values.
 func (c Config) New() (Engine, error) {
-	driverType := c.Type
-	if driverType == "" {
-		// Fallback to c.Name for the driver type.
-		driverType = c.Name
-	}
+	driverType := c.driverType()
 	if driverType == "" {
 		// Both c.Name and c.Type is empty.
 		return nil, fmt.Errorf("engine config has no name or type")
@@ -144,12 +205,63 @@ func (c Config) New() (Engine, error) {
 		c.Name = c.Type
 	}
 
+	if c.RequestsPerMinute < 0 || c.Burst < 0 || c.DailyBudget < 0 {
+		return nil, fmt.Errorf("engine %q: rate limits must not be negative", c.Name)
+	}
+
+	if err := c.validateProxies(); err != nil {
+		return nil, fmt.Errorf("engine %q: %w", c.Name, err)
+	}
+
 	// Initialize the driver, if we found it.
 	fn, ok := engines[driverType]
 	if !ok {
 		return nil, fmt.Errorf("engine %q is not known", driverType)
 	}
-	return fn(c)
+
+	var err error
+	c.Settings, err = c.decodeSettings(driverType)
+	if err != nil {
+		return nil, fmt.Errorf("engine %q: %w", c.Name, err)
+	}
+
+	e, err := fn(c)
+	if err != nil {
+		return nil, fmt.Errorf("engine %q: %w", c.Name, err)
+	}
+	return e, nil
+}
+
+// Determines the HTTP proxy to use for this engine.
+func (c Config) httpProxy() string {
+	switch c.HttpProxy {
+	case "":
+		// Try to pull a value from the environment.
+		// At worst, this does nothing and returns "".
+		return os.Getenv("HTTP_PROXY")
+	case "-":
+		// Special value to force no configuration.
+		return ""
+	default:
+		return c.HttpProxy
+	}
+}
+
+// Checks that the proxy settings are usable.
+func (c Config) validateProxies() error {
+	proxy := c.httpProxy()
+	if proxy != "" {
+		if _, err := parseProxyURL(proxy); err != nil {
+			return err
+		}
+	}
+
+	if c.QUIC && (proxy != "" || len(c.HttpProxies) > 0) {
+		return errQUICProxy
+	}
+
+	_, err := newProxyPool(c.HttpProxies, c.ProxyStrategy, c.ProxyBench.Duration, "")
+	return err
 }
 
 // MustNew attempts to initialize an [Engine] from the configuration, but
@@ -186,25 +298,76 @@ func (c Config) NewHttpClient() *HttpClient {
 		userAgent = DefaultUserAgent
 	}
 
-	// Determine the HTTP proxy to use for this engine.
-	httpProxy := c.HttpProxy
-	if httpProxy == "" {
-		// Try to pull a value from the environment.
-		// At worst, this does nothing and sets it to "".
-		httpProxy = os.Getenv("HTTP_PROXY")
-	} else if httpProxy == "-" {
-		// Special value to force no configuration.
-		httpProxy = ""
+	isolation := ""
+	if c.ProxyIsolation {
+		isolation = c.Name
 	}
 
-	return &HttpClient{
+	h := &HttpClient{
 		Timeout:   timeout,
 		UserAgent: userAgent,
-		HttpProxy: httpProxy,
+		HttpProxy: c.httpProxy(),
 		Debug:     c.Debug,
 		QUIC:      c.QUIC,
 		QUIC_0RTT: c.QUIC_0RTT,
+
+		HttpProxies:   c.HttpProxies,
+		ProxyStrategy: c.ProxyStrategy,
+		ProxyBench:    c.ProxyBench.Duration,
+
+		ProxyIsolation: isolation,
+
+		RequestsPerMinute: c.RequestsPerMinute,
+		Burst:             c.Burst,
+		DailyBudget:       c.DailyBudget,
+	}
+
+	registerClient(c.Name, h)
+	return h
+}
+
+// ConfigKeys returns the keys of all settings of [Config] that every engine
+// accepts.
+var ConfigKeys = sync.OnceValue(func() []string {
+	keys := []string{}
+
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+
+	return keys
+})
+
+// UnknownSettings returns the keys of Extra that the engine does not accept,
+// as declared in its [Capabilities], in sorted order.
+//
+// Engines of an unknown type accept nothing.
+func (c Config) UnknownSettings() []string {
+	settings := SettingsOf(c.driverType())
+
+	keys := []string{}
+	for k := range c.Extra {
+		if !slices.ContainsFunc(settings, func(s Setting) bool { return s.Key == k }) {
+			keys = append(keys, k)
+		}
 	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// Equal determines if engines created from c and o would behave the same.
+//
+// Weight is ignored since it only matters for ranking, as is where the
+// configurations were decoded from.
+func (c Config) Equal(o Config) bool {
+	c.Weight, o.Weight = 0, 0
+	c.node, o.node = nil, nil
+	return reflect.DeepEqual(c, o)
 }
 
 // UnmarshalJSON parses a JSON configuration.
@@ -242,10 +405,14 @@ func (c *Config) UnmarshalYAML(data *yaml.Node) error {
 	// Since we parsed it as map[string]any, it includes *all* keys, even
 	// those which have a corresponding field.
 	// Remove those.
-	for _, key := range []string{"type", "name", "user_agent", "timeout", "weight", "debug"} {
+	for _, key := range ConfigKeys() {
 		delete(d.Extra, key)
 	}
 
+	// Keep the node so errors in engine-specific settings can point at
+	// their line.
+	d.node = data
+
 	// Set the receiver to the parsed config and return nil.
 	*c = Config(d)
 	return nil
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"slices"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type dummyEngine struct {
@@ -30,7 +33,7 @@ func init() {
 	})
 }
 
-func (d *dummyEngine) Search(ctx context.Context, query string, page int) ([]Result, error) {
+func (d *dummyEngine) Search(ctx context.Context, query string, page int, opts Options) ([]Result, error) {
 	// Just send a request to somewhere to make sure it works
 	res, err := d.http.Get(ctx, "http://example.com")
 	if err != nil {
@@ -81,8 +84,24 @@ func TestConfigHttpProxy(t *testing.T) {
 		Type:      "dummy",
 		HttpProxy: "http://" + l.Addr().String(),
 	}).New()
-	_, err = eng.Search(ctx, "", -1)
+	_, err = eng.Search(ctx, "", -1, Options{})
 	if err != nil {
 		t.Errorf("expected err = nil, got %v", err)
 	}
 }
+
+func TestConfigUnknownSettings(t *testing.T) {
+	var c Config
+	data := "type: settings\nendpoint: x\nquic: true\nhttp_proxy: \"-\"\nwieght: 2\n"
+	if err := yaml.Unmarshal([]byte(data), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Extra["quic"]; ok {
+		t.Errorf("known setting left in Extra: %v", c.Extra)
+	}
+
+	if got := c.UnknownSettings(); !slices.Equal(got, []string{"wieght"}) {
+		t.Errorf("UnknownSettings() = %v", got)
+	}
+}
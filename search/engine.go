@@ -5,8 +5,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Engine is an interface that implements the bare essentials for doing web
@@ -16,7 +18,76 @@ type Engine interface {
 	Ping(ctx context.Context) error
 
 	// Search attempts to query the engine and returns a number of results.
-	Search(ctx context.Context, query string, page int) ([]Result, error)
+	//
+	// opts should be mapped to the engine's own parameters where
+	// possible.
+	Search(ctx context.Context, query string, page int, opts Options) ([]Result, error)
+}
+
+// Category is a kind of search, such as web pages or images.
+type Category string
+
+// Supported search categories.
+const (
+	CategoryWeb    Category = "web"
+	CategoryImages Category = "images"
+	CategoryNews   Category = "news"
+	CategoryVideos Category = "videos"
+)
+
+// Categories holds all supported categories in the order they should be
+// shown.
+var Categories = []Category{CategoryWeb, CategoryImages, CategoryNews, CategoryVideos}
+
+// CategoryEngine is an optional interface that an [Engine] can implement to
+// search categories other than [CategoryWeb].
+//
+// Every engine is assumed to support [CategoryWeb] through [Engine.Search].
+type CategoryEngine interface {
+	Engine
+
+	// Categories returns the categories that the engine supports in
+	// addition to [CategoryWeb].
+	Categories() []Category
+
+	// SearchCategory is like [Engine.Search] but searches a specific
+	// category.
+	// It is never called with [CategoryWeb].
+	SearchCategory(ctx context.Context, category Category, query string, page int, opts Options) ([]Result, error)
+}
+
+// Supports determines if an engine is able to search a category.
+func Supports(e Engine, category Category) bool {
+	if category == CategoryWeb {
+		return true
+	}
+
+	ce, ok := e.(CategoryEngine)
+	return ok && slices.Contains(ce.Categories(), category)
+}
+
+// SearchCategory searches a category of an engine, using [Engine.Search] for
+// [CategoryWeb].
+//
+// The options are also attached to ctx; see [OptionsFromContext].
+// If the engine returns [ErrCaptcha], the proxies it used are benched.
+func SearchCategory(ctx context.Context, e Engine, category Category, query string, page int, opts Options) ([]Result, error) {
+	ctx = withOptions(ctx, opts)
+	ctx = withSearchCharge(ctx)
+	ctx, trace := withProxyTrace(ctx, query)
+
+	var res []Result
+	var err error
+	if category == CategoryWeb {
+		res, err = e.Search(ctx, query, page, opts)
+	} else if ce, ok := e.(CategoryEngine); ok && slices.Contains(ce.Categories(), category) {
+		res, err = ce.SearchCategory(ctx, category, query, page, opts)
+	} else {
+		return nil, fmt.Errorf("category %q is not supported", category)
+	}
+
+	trace.finish(err)
+	return res, err
 }
 
 // An Initializer is a function that initializes an engine from a config.
@@ -45,10 +116,136 @@ type Result struct {
 	//
 	// Engines should not fill this value.
 	Score float64 `json:"score,omitempty"`
+
+	// Rank is the position of this result in the results returned by an
+	// engine, starting at 1.
+	// When results are merged, this holds the best rank of all engines
+	// that returned the result.
+	//
+	// Engines should not fill this value; it is filled in from the order
+	// of the results that the engine returns.
+	Rank int `json:"rank,omitempty"`
+
+	// Alternates holds links to other copies of this result, such as
+	// mirrors or mobile versions, whose title and description are nearly
+	// the same.
+	//
+	// Engines should not fill this value.
+	Alternates []string `json:"alternates,omitempty"`
+
+	// Thumbnail is a link to a small preview image of this result.
+	// For images, Link is the page that the image is on.
+	Thumbnail string `json:"thumbnail,omitempty"`
+
+	// Published is when the page was published, if known.
+	// This is mostly set for news and videos.
+	Published *time.Time `json:"published,omitempty"`
+
+	// Duration is the length of a video.
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Site is the name of the website that this result is from, such as
+	// the name of a news outlet.
+	Site string `json:"site,omitempty"`
 }
 
 var engines = map[string]Initializer{}
 var defaultEngines = map[string]struct{}{}
+var capabilities = map[string]Capabilities{}
+
+// Capabilities describes what an engine is able to do.
+//
+// Engines declare their capabilities when they are added with [Add].
+// Operators and categories are also taken from the [SyntaxEngine] and
+// [CategoryEngine] interfaces; see [CapabilitiesOf].
+type Capabilities struct {
+	// Paging is true if the engine can return more than the first page.
+	Paging bool `json:"paging"`
+
+	// MaxPage is the highest page the engine can return, starting at 0.
+	// Zero means there is no limit if Paging is true.
+	MaxPage int `json:"max_page,omitempty"`
+
+	// Operators holds the search operators that the engine understands.
+	Operators []Operator `json:"operators,omitempty"`
+
+	// Categories holds the categories that the engine can search.
+	Categories []Category `json:"categories,omitempty"`
+
+	// Languages holds the languages, as ISO 639-1 codes, that the engine
+	// has results in.
+	// An empty list means any language.
+	Languages []string `json:"languages,omitempty"`
+
+	// TimeRange is true if the engine can limit results to a
+	// [TimeRange].
+	TimeRange bool `json:"time_range"`
+
+	// SafeSearch is true if the engine can filter explicit results.
+	SafeSearch bool `json:"safe_search"`
+
+	// NeedsConfig is true if the engine can't be used without being
+	// configured.
+	NeedsConfig bool `json:"needs_config"`
+
+	// Settings holds the defaults of the engine-specific settings that
+	// the engine accepts in [Config.Extra], as a struct; see [Setting].
+	// Engines find the decoded settings in [Config.Settings].
+	//
+	// A nil value means the engine accepts no settings.
+	Settings any `json:"-"`
+}
+
+// Capabilities assumed of engines that don't declare any.
+var defaultCapabilities = Capabilities{Paging: true}
+
+// SupportsPage determines if the engine can return the page.
+func (c Capabilities) SupportsPage(page int) bool {
+	if page == 0 {
+		return true
+	}
+
+	return c.Paging && (c.MaxPage == 0 || page <= c.MaxPage)
+}
+
+// SupportsLanguage determines if the engine has results in the language.
+func (c Capabilities) SupportsLanguage(lang string) bool {
+	return lang == "" || len(c.Languages) == 0 || slices.Contains(c.Languages, lang)
+}
+
+// CapabilitiesOf returns the capabilities of an engine of a type, as given to
+// [Add], with the operators and categories that e declares.
+func CapabilitiesOf(driverType string, e Engine) Capabilities {
+	caps, ok := capabilities[driverType]
+	if !ok {
+		caps = defaultCapabilities
+	}
+
+	// Don't modify the registry.
+	caps.Operators = slices.Clone(caps.Operators)
+	caps.Categories = append([]Category{CategoryWeb}, caps.Categories...)
+
+	if se, ok := e.(SyntaxEngine); ok {
+		for op := range se.Syntax() {
+			if !slices.Contains(caps.Operators, op) {
+				caps.Operators = append(caps.Operators, op)
+			}
+		}
+	}
+
+	if ce, ok := e.(CategoryEngine); ok {
+		for _, c := range ce.Categories() {
+			if !slices.Contains(caps.Categories, c) {
+				caps.Categories = append(caps.Categories, c)
+			}
+		}
+	}
+
+	// Maps have no order.
+	slices.Sort(caps.Operators)
+
+	return caps
+}
 
 // Well-defined errors.
 var (
@@ -57,6 +254,14 @@ var (
 	// due to changes in the search engine itself which will require
 	// changes in the engine's code.
 	ErrCaptcha = errors.New("engine returned captcha response")
+
+	// The engine responded with something that it could not make sense
+	// of, which usually means the engine needs to be updated.
+	ErrParse = errors.New("unexpected response from engine")
+
+	// The request was not sent because the engine has reached the rate
+	// limit or daily budget set in its [Config].
+	ErrRateLimited = errors.New("engine rate limit reached")
 )
 
 var Supported = sync.OnceValue(func() []string {
@@ -77,16 +282,28 @@ var DefaultEngines = sync.OnceValue(func() []string {
 
 // Add adds a search engine to the list of supported engines.
 //
+// The capabilities of the engine may optionally be specified; engines that
+// don't are assumed to support pagination and nothing else.
+//
 // If a name is already in use, Add panics.
-func Add(name string, isDefault bool, fn Initializer) {
+func Add(name string, isDefault bool, fn Initializer, caps ...Capabilities) {
 	if _, ok := engines[name]; ok {
 		panic(fmt.Sprintf("name %q already taken", name))
 	}
 
+	if len(caps) > 1 {
+		panic(fmt.Sprintf("engine %q has more than one set of capabilities", name))
+	}
+
 	engines[name] = fn
 	if isDefault {
 		defaultEngines[name] = struct{}{}
 	}
+
+	capabilities[name] = defaultCapabilities
+	if len(caps) == 1 {
+		capabilities[name] = caps[0]
+	}
 }
 
 // Strips the preceeding http:// or https:// from the link.
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// An engine that declares its syntax and categories.
+type capsEngine struct {
+	dummyEngine
+}
+
+func (c *capsEngine) Syntax() Syntax {
+	return Syntax{OpSite: "site:", OpPhrase: `"`}
+}
+
+func (c *capsEngine) Categories() []Category {
+	return []Category{CategoryNews}
+}
+
+func (c *capsEngine) SearchCategory(ctx context.Context, category Category, query string, page int, opts Options) ([]Result, error) {
+	return nil, nil
+}
+
+func init() {
+	Add("caps", false, func(config Config) (Engine, error) {
+		return &capsEngine{}, nil
+	}, Capabilities{Paging: true, MaxPage: 4, SafeSearch: true})
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	caps := CapabilitiesOf("caps", &capsEngine{})
+	want := Capabilities{
+		Paging:     true,
+		MaxPage:    4,
+		Operators:  []Operator{OpPhrase, OpSite},
+		Categories: []Category{CategoryWeb, CategoryNews},
+		SafeSearch: true,
+	}
+	if !reflect.DeepEqual(caps, want) {
+		t.Errorf("%#v != %#v", caps, want)
+	}
+
+	// Engines that declare nothing are assumed to page.
+	caps = CapabilitiesOf("dummy", &dummyEngine{})
+	if !caps.Paging || len(caps.Operators) != 0 || !reflect.DeepEqual(caps.Categories, []Category{CategoryWeb}) {
+		t.Errorf("unexpected default capabilities: %#v", caps)
+	}
+}
+
+func TestCapabilitiesSupportsPage(t *testing.T) {
+	tests := []struct {
+		caps Capabilities
+		page int
+		ok   bool
+	}{
+		{Capabilities{}, 0, true},
+		{Capabilities{}, 1, false},
+		{Capabilities{Paging: true}, 100, true},
+		{Capabilities{Paging: true, MaxPage: 4}, 4, true},
+		{Capabilities{Paging: true, MaxPage: 4}, 5, false},
+	}
+
+	for _, v := range tests {
+		if v.caps.SupportsPage(v.page) != v.ok {
+			t.Errorf("%+v.SupportsPage(%d) = %v, want %v", v.caps, v.page, !v.ok, v.ok)
+		}
+	}
+}
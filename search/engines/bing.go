@@ -2,8 +2,13 @@ package engines
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
 )
@@ -15,23 +20,56 @@ type bing struct {
 }
 
 var (
-	_ search.Engine = &bing{}
+	_ search.Engine         = &bing{}
+	_ search.SyntaxEngine   = &bing{}
+	_ search.CategoryEngine = &bing{}
 )
 
+// Metadata attached to image results in the "m" attribute.
+type bingImageMeta struct {
+	// Page the image is on.
+	PageURL string `json:"purl"`
+
+	// Thumbnail of the image.
+	ThumbURL string `json:"turl"`
+
+	Title string `json:"t"`
+	Desc  string `json:"desc"`
+}
+
+// Metadata attached to video results in the "vrhm" attribute.
+type bingVideoMeta struct {
+	// Page of the video.
+	URL string `json:"murl"`
+
+	Title    string `json:"vt"`
+	Duration string `json:"du"`
+}
+
 func init() {
 	search.Add("bing", false, func(config search.Config) (search.Engine, error) {
 		return &bing{
 			name: config.Name,
 			http: config.NewHttpClient(),
 		}, nil
+	}, search.Capabilities{
+		Paging:     true,
+		TimeRange:  true,
+		SafeSearch: true,
 	})
 }
 
 // Search attempts to query the engine and returns a number of results.
-func (b *bing) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (b *bing) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
 	form.Set("q", query)
+	setBingOptions(form, opts)
+
+	// The time range is only supported by web results.
+	if filter := bingTimeFilter(opts.TimeRange, time.Now()); filter != "" {
+		form.Set("filters", filter)
+	}
 
 	if page >= 1 {
 		form.Set("first", fmt.Sprint(10*page))
@@ -76,9 +114,233 @@ func (b *bing) Search(ctx context.Context, query string, page int) ([]search.Res
 	return results, nil
 }
 
+// Sets the parameters of a request from the search options.
+func setBingOptions(form url.Values, opts search.Options) {
+	if opts.Language != "" {
+		form.Set("setlang", opts.Language)
+	}
+
+	if opts.Region != "" {
+		form.Set("cc", opts.Region)
+	}
+
+	if opts.Language != "" && opts.Region != "" {
+		form.Set("mkt", opts.Locale())
+	}
+
+	// Bing uses the same names.
+	if opts.SafeSearch != "" {
+		form.Set("adlt", string(opts.SafeSearch))
+	}
+}
+
+// Determines the value of the filters parameter for a time range.
+//
+// Bing has presets for the last day, week and month; anything else is a
+// range of days since the Unix epoch.
+func bingTimeFilter(tr search.TimeRange, now time.Time) string {
+	switch tr {
+	case search.TimeRangeDay:
+		return `ex1:"ez1"`
+	case search.TimeRangeWeek:
+		return `ex1:"ez2"`
+	case search.TimeRangeMonth:
+		return `ex1:"ez3"`
+	case search.TimeRangeYear:
+		today := now.Unix() / 86400
+		return fmt.Sprintf(`ex1:"ez5_%d_%d"`, today-365, today)
+	default:
+		return ""
+	}
+}
+
+// Fetches a page from Bing.
+func (b *bing) get(ctx context.Context, path string, form url.Values) (*goquery.Document, error) {
+	ctx, cancel := b.http.Context(ctx)
+	defer cancel()
+
+	_, doc, err := b.http.HtmlGet(ctx, "https://www.bing.com"+path+"?"+form.Encode())
+	return doc, err
+}
+
+func (b *bing) Categories() []search.Category {
+	return []search.Category{search.CategoryImages, search.CategoryNews, search.CategoryVideos}
+}
+
+// SearchCategory attempts to query a category of the engine and returns a
+// number of results.
+func (b *bing) SearchCategory(ctx context.Context, category search.Category, query string, page int, opts search.Options) ([]search.Result, error) {
+	switch category {
+	case search.CategoryImages:
+		return b.searchImages(ctx, query, page, opts)
+	case search.CategoryNews:
+		return b.searchNews(ctx, query, page, opts)
+	case search.CategoryVideos:
+		return b.searchVideos(ctx, query, page, opts)
+	default:
+		return nil, fmt.Errorf("category %q is not supported", category)
+	}
+}
+
+func (b *bing) searchImages(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
+	form := url.Values{}
+	form.Set("q", query)
+	setBingOptions(form, opts)
+	form.Set("async", "1")
+	form.Set("count", "35")
+	form.Set("first", fmt.Sprint(35*page+1))
+
+	// The async endpoint returns just the results without the rest of the
+	// page.
+	doc, err := b.get(ctx, "/images/async", form)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each image is a.iusc with all of the useful information stored as
+	// JSON in the "m" attribute.
+	elem := doc.Find(`a.iusc`)
+
+	results := make([]search.Result, 0, elem.Length())
+
+	for i := 0; i < elem.Length(); i++ {
+		m, _ := elem.Eq(i).Attr("m")
+
+		meta := bingImageMeta{}
+		if err := json.Unmarshal([]byte(m), &meta); err != nil || meta.PageURL == "" {
+			continue
+		}
+
+		results = append(results, search.Result{
+			Link:        search.CleanURL(meta.PageURL),
+			Title:       meta.Title,
+			Description: meta.Desc,
+			Thumbnail:   meta.ThumbURL,
+			Sources:     []string{b.name},
+		})
+	}
+
+	return results, nil
+}
+
+func (b *bing) searchNews(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
+	form := url.Values{}
+	form.Set("q", query)
+	setBingOptions(form, opts)
+	form.Set("InfiniteScroll", "1")
+	form.Set("first", fmt.Sprint(10*page+1))
+
+	doc, err := b.get(ctx, "/news/infinitescrollajax", form)
+	if err != nil {
+		return nil, err
+	}
+
+	// News results are laid out like this:
+	// div.news-card: has url, data-title and data-author attributes
+	// div.snippet: desc
+	// img: thumbnail
+	elem := doc.Find(`div.news-card`)
+
+	results := make([]search.Result, 0, elem.Length())
+
+	for i := 0; i < elem.Length(); i++ {
+		e := elem.Eq(i)
+
+		v := search.Result{}
+		v.Link, _ = e.Attr("url")
+		if v.Link == "" {
+			continue
+		}
+
+		v.Link = search.CleanURL(v.Link)
+		v.Title, _ = e.Attr("data-title")
+		v.Site, _ = e.Attr("data-author")
+		v.Description = strings.TrimSpace(e.Find("div.snippet").Text())
+
+		// Thumbnails are lazy loaded and not always in src.
+		img := e.Find("img").First()
+		if src, ok := img.Attr("data-src"); ok {
+			v.Thumbnail = src
+		} else {
+			v.Thumbnail, _ = img.Attr("src")
+		}
+		v.Thumbnail = absoluteBingURL(v.Thumbnail)
+
+		v.Sources = []string{b.name}
+
+		results = append(results, v)
+	}
+
+	return results, nil
+}
+
+func (b *bing) searchVideos(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
+	form := url.Values{}
+	form.Set("q", query)
+	setBingOptions(form, opts)
+	form.Set("async", "content")
+	form.Set("count", "35")
+	form.Set("first", fmt.Sprint(35*page+1))
+
+	doc, err := b.get(ctx, "/videos/asyncv2", form)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like images, videos keep their information as JSON, this time in
+	// the "vrhm" attribute.
+	elem := doc.Find(`div.dg_u`)
+
+	results := make([]search.Result, 0, elem.Length())
+
+	for i := 0; i < elem.Length(); i++ {
+		e := elem.Eq(i)
+
+		m, _ := e.Find(`div[vrhm]`).Attr("vrhm")
+
+		meta := bingVideoMeta{}
+		if err := json.Unmarshal([]byte(m), &meta); err != nil || meta.URL == "" {
+			continue
+		}
+
+		v := search.Result{
+			Link:    search.CleanURL(meta.URL),
+			Title:   meta.Title,
+			Sources: []string{b.name},
+		}
+
+		v.Duration, _ = search.ParseClock(meta.Duration)
+		v.Description = strings.TrimSpace(e.Find(`.mc_vtvc_meta_block`).Text())
+
+		img := e.Find(`.mc_vtvc_th img`).First()
+		if src, ok := img.Attr("data-src"); ok {
+			v.Thumbnail = src
+		} else {
+			v.Thumbnail, _ = img.Attr("src")
+		}
+		v.Thumbnail = absoluteBingURL(v.Thumbnail)
+
+		results = append(results, v)
+	}
+
+	return results, nil
+}
+
+// Bing links to its own thumbnails without the hostname.
+func absoluteBingURL(link string) string {
+	if strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") {
+		return "https://www.bing.com" + link
+	}
+	return link
+}
+
 // Ping checks to see if the engine is reachable.
 func (b *bing) Ping(ctx context.Context) error {
 	// Just access the index to see if we're okay.
 	_, err := b.http.Get(ctx, "https://www.bing.com/")
 	return err
 }
+
+func (b *bing) Syntax() search.Syntax {
+	return search.DefaultSyntax
+}
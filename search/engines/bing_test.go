@@ -16,7 +16,7 @@ func TestBingSearch(t *testing.T) {
 
 	d := (search.Config{Type: "bing"}).MustNew()
 
-	res, err := d.Search(context.Background(), "hello world", 0)
+	res, err := d.Search(context.Background(), "hello world", 0, search.Options{})
 	if err != nil {
 		panic(err)
 	} else if len(res) == 0 {
@@ -30,7 +30,7 @@ func TestBingSearch(t *testing.T) {
 	}
 
 	// Ensure page 1 has results
-	res, err = d.Search(context.Background(), "hello world", 1)
+	res, err = d.Search(context.Background(), "hello world", 1, search.Options{})
 	if err != nil {
 		panic(err)
 	} else if len(res) == 0 {
@@ -44,7 +44,7 @@ func TestBingSearch(t *testing.T) {
 	}
 
 	// Ensure page 2 has results
-	res, err = d.Search(context.Background(), "hello world", 2)
+	res, err = d.Search(context.Background(), "hello world", 2, search.Options{})
 	if err != nil {
 		panic(err)
 	} else if len(res) == 0 {
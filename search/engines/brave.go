@@ -3,7 +3,11 @@ package engines
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
 )
@@ -14,7 +18,9 @@ type brave struct {
 }
 
 var (
-	_ search.Engine = &brave{}
+	_ search.Engine         = &brave{}
+	_ search.SyntaxEngine   = &brave{}
+	_ search.CategoryEngine = &brave{}
 )
 
 func init() {
@@ -28,11 +34,67 @@ func init() {
 			name: config.Name,
 			http: cli,
 		}, nil
+	}, search.Capabilities{
+		Paging:     true,
+		TimeRange:  true,
+		SafeSearch: true,
 	})
 }
 
+// Values of the tf parameter for each time range.
+var braveTimeRanges = map[search.TimeRange]string{
+	search.TimeRangeDay:   "pd",
+	search.TimeRangeWeek:  "pw",
+	search.TimeRangeMonth: "pm",
+	search.TimeRangeYear:  "py",
+}
+
+// Fetches a results page.
+//
+// Brave takes most of its settings from cookies rather than parameters.
+func (b *brave) get(ctx context.Context, path string, form url.Values, opts search.Options) (*goquery.Document, error) {
+	if tf, ok := braveTimeRanges[opts.TimeRange]; ok {
+		form.Set("tf", tf)
+	}
+
+	ctx, cancel := b.http.Context(ctx)
+	defer cancel()
+
+	link := "https://search.brave.com/" + path + "?" + form.Encode()
+
+	req, err := b.http.New(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Brave uses the same names for safe search levels.
+	if opts.SafeSearch != "" {
+		req.AddCookie(&http.Cookie{Name: "safesearch", Value: string(opts.SafeSearch)})
+	}
+
+	if opts.Region != "" {
+		req.AddCookie(&http.Cookie{Name: "country", Value: strings.ToLower(opts.Region)})
+	}
+
+	if opts.Language != "" {
+		req.AddCookie(&http.Cookie{Name: "ui_lang", Value: strings.ToLower(opts.Locale())})
+	}
+
+	res, err := b.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, search.HttpError{Status: res.StatusCode, URL: link, Method: "GET"}
+	}
+
+	return search.DocumentFromHttpResponse(res)
+}
+
 // Search attempts to query the engine and returns a number of results.
-func (b *brave) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (b *brave) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
 	form.Set("q", query)
@@ -41,13 +103,7 @@ func (b *brave) Search(ctx context.Context, query string, page int) ([]search.Re
 		form.Set("offset", fmt.Sprint(page))
 	}
 
-	ctx, cancel := b.http.Context(ctx)
-	defer cancel()
-
-	_, doc, err := b.http.HtmlGet(
-		ctx,
-		"https://search.brave.com/search?"+form.Encode(),
-	)
+	doc, err := b.get(ctx, "search", form, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -94,9 +150,69 @@ func (b *brave) Search(ctx context.Context, query string, page int) ([]search.Re
 	return results, nil
 }
 
+func (b *brave) Categories() []search.Category {
+	return []search.Category{search.CategoryNews, search.CategoryVideos}
+}
+
+// SearchCategory attempts to query a category of the engine and returns a
+// number of results.
+func (b *brave) SearchCategory(ctx context.Context, category search.Category, query string, page int, opts search.Options) ([]search.Result, error) {
+	if category != search.CategoryNews && category != search.CategoryVideos {
+		return nil, fmt.Errorf("category %q is not supported", category)
+	}
+
+	form := url.Values{}
+
+	form.Set("q", query)
+
+	if page >= 1 {
+		form.Set("offset", fmt.Sprint(page))
+	}
+
+	// The pages are named after the category.
+	doc, err := b.get(ctx, string(category), form, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// News and video results are laid out like web results, but with a
+	// thumbnail, the name of the website and, for videos, the duration
+	// over the thumbnail.
+	elem := doc.Find(`#results .snippet`)
+
+	results := make([]search.Result, 0, elem.Length())
+
+	for i := 0; i < elem.Length(); i++ {
+		v := search.Result{}
+		e := elem.Eq(i)
+
+		v.Link, _ = e.Find("a").First().Attr("href")
+		if v.Link == "" || strings.HasPrefix(v.Link, "/") {
+			// Not a result.
+			continue
+		}
+
+		v.Link = search.CleanURL(v.Link)
+		v.Title = strings.TrimSpace(e.Find(".title").Text())
+		v.Description = strings.TrimSpace(e.Find(".snippet-description").Text())
+		v.Site = strings.TrimSpace(e.Find(".netloc").First().Text())
+		v.Thumbnail, _ = e.Find("img").First().Attr("src")
+		v.Duration, _ = search.ParseClock(e.Find(".duration").Text())
+		v.Sources = []string{b.name}
+
+		results = append(results, v)
+	}
+
+	return results, nil
+}
+
 // Ping checks to see if the engine is reachable.
 func (b *brave) Ping(ctx context.Context) error {
 	// Just access the index to see if we're okay.
 	_, err := b.http.Get(ctx, "https://search.brave.com/")
 	return err
 }
+
+func (b *brave) Syntax() search.Syntax {
+	return search.DefaultSyntax
+}
@@ -2,11 +2,15 @@ package engines
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
 )
@@ -26,9 +30,56 @@ type ddg struct {
 }
 
 var (
-	_ search.Engine = &ddg{}
+	_ search.Engine         = &ddg{}
+	_ search.SyntaxEngine   = &ddg{}
+	_ search.CategoryEngine = &ddg{}
 )
 
+// Finds the vqd value in a results page.
+var ddgVqdRegexp = regexp.MustCompile(`vqd=["']?([0-9-]+)`)
+
+// Endpoints of the DDG JSON API for each category, along with the number of
+// results on each page.
+var ddgCategories = map[search.Category]struct {
+	path    string
+	perPage int
+}{
+	search.CategoryImages: {"i.js", 100},
+	search.CategoryNews:   {"news.js", 30},
+	search.CategoryVideos: {"v.js", 60},
+}
+
+// A single result of the DDG JSON API.
+//
+// The fields that are set depend on the category.
+type ddgResult struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+
+	// Images.
+	Thumbnail string `json:"thumbnail"`
+	Source    string `json:"source"`
+
+	// News.
+	Excerpt string `json:"excerpt"`
+	Date    int64  `json:"date"`
+	Image   string `json:"image"`
+
+	// Videos.
+	Content     string `json:"content"`
+	Description string `json:"description"`
+	Duration    string `json:"duration"`
+	Published   string `json:"published"`
+	Publisher   string `json:"publisher"`
+	Images      struct {
+		Medium string `json:"medium"`
+	} `json:"images"`
+}
+
+type ddgResponse struct {
+	Results []ddgResult `json:"results"`
+}
+
 func init() {
 	search.Add("ddg", true, func(config search.Config) (search.Engine, error) {
 		return &ddg{
@@ -36,6 +87,10 @@ func init() {
 			http: config.NewHttpClient(),
 			vqd:  map[string]string{},
 		}, nil
+	}, search.Capabilities{
+		Paging:     true,
+		TimeRange:  true,
+		SafeSearch: true,
 	})
 }
 
@@ -112,6 +167,31 @@ func decodeDDGHref(href string) string {
 	return v.Get("uddg")
 }
 
+// Values of the kp parameter for each safe search level.
+var ddgSafeSearch = map[search.SafeSearch]string{
+	search.SafeSearchOff:      "-2",
+	search.SafeSearchModerate: "-1",
+	search.SafeSearchStrict:   "1",
+}
+
+// Sets the parameters of a request from the search options.
+func setDDGOptions(form url.Values, opts search.Options) {
+	// DDG regions are a combination of a country and a language, such as
+	// "us-en", so both are needed.
+	if opts.Language != "" && opts.Region != "" {
+		form.Set("kl", strings.ToLower(opts.Region)+"-"+opts.Language)
+	}
+
+	if kp, ok := ddgSafeSearch[opts.SafeSearch]; ok {
+		form.Set("kp", kp)
+	}
+
+	if opts.TimeRange != "" {
+		// d, w, m or y.
+		form.Set("df", string(opts.TimeRange)[:1])
+	}
+}
+
 // Escapes bangs when they appear in the query.
 func encodeDDGQuery(query string) string {
 	if !strings.ContainsRune(query, '!') {
@@ -129,10 +209,11 @@ func encodeDDGQuery(query string) string {
 }
 
 // Search attempts to query the engine and returns a number of results.
-func (d *ddg) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (d *ddg) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
 	form.Set("q", encodeDDGQuery(query))
+	setDDGOptions(form, opts)
 	if vqd := d.lookupVqd(query); vqd != "" {
 		form.Set("vqd", vqd)
 	}
@@ -235,9 +316,162 @@ func (d *ddg) Search(ctx context.Context, query string, page int) ([]search.Resu
 	return results, nil
 }
 
+// Fetches the vqd value for a query from the main DDG website.
+//
+// Lite's vqd is used instead if there is one.
+func (d *ddg) fetchVqd(ctx context.Context, query string) (string, error) {
+	if vqd := d.lookupVqd(query); vqd != "" {
+		return vqd, nil
+	}
+
+	form := url.Values{}
+	form.Set("q", encodeDDGQuery(query))
+
+	res, err := d.http.Get(ctx, "https://duckduckgo.com/?"+form.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	m := ddgVqdRegexp.FindSubmatch(body)
+	if m == nil {
+		return "", fmt.Errorf("%w: failed to find vqd", search.ErrParse)
+	}
+
+	d.setVqd(query, string(m[1]))
+	return string(m[1]), nil
+}
+
+func (d *ddg) Categories() []search.Category {
+	return []search.Category{search.CategoryImages, search.CategoryNews, search.CategoryVideos}
+}
+
+// SearchCategory attempts to query a category of the engine and returns a
+// number of results.
+func (d *ddg) SearchCategory(ctx context.Context, category search.Category, query string, page int, opts search.Options) ([]search.Result, error) {
+	endpoint, ok := ddgCategories[category]
+	if !ok {
+		return nil, fmt.Errorf("category %q is not supported", category)
+	}
+
+	ctx, cancel := d.http.Context(ctx)
+	defer cancel()
+
+	vqd, err := d.fetchVqd(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("q", encodeDDGQuery(query))
+	form.Set("vqd", vqd)
+	setDDGOptions(form, opts)
+	form.Set("o", "json")
+	form.Set("p", "1")
+	form.Set("s", fmt.Sprint(page*endpoint.perPage))
+
+	link := "https://duckduckgo.com/" + endpoint.path + "?" + form.Encode()
+
+	req, err := d.http.New(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Same deal as lite; no referer means no results.
+	req.Header.Set("Referer", "https://duckduckgo.com/")
+
+	res, err := d.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 403 {
+		// The vqd is likely stale or we've been flagged.
+		return nil, search.ErrCaptcha
+	} else if res.StatusCode != 200 {
+		return nil, search.HttpError{
+			Status: res.StatusCode,
+			URL:    link,
+			Method: "GET",
+		}
+	}
+
+	data := ddgResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode response: %w", search.ErrParse, err)
+	}
+
+	results := make([]search.Result, 0, len(data.Results))
+
+	for _, r := range data.Results {
+		if v, ok := d.toNativeResult(category, r); ok {
+			results = append(results, v)
+		}
+	}
+
+	return results, nil
+}
+
+// Converts a result of the DDG JSON API to a [search.Result].
+func (d *ddg) toNativeResult(category search.Category, r ddgResult) (search.Result, bool) {
+	v := search.Result{
+		Title:   r.Title,
+		Sources: []string{d.name},
+	}
+
+	switch category {
+	case search.CategoryImages:
+		v.Link = r.URL
+		v.Thumbnail = r.Thumbnail
+		v.Site = r.Source
+	case search.CategoryNews:
+		v.Link = r.URL
+		v.Description = r.Excerpt
+		v.Thumbnail = r.Image
+		v.Site = r.Source
+
+		if r.Date > 0 {
+			t := time.Unix(r.Date, 0)
+			v.Published = &t
+		}
+	case search.CategoryVideos:
+		v.Link = r.Content
+		v.Description = r.Description
+		v.Thumbnail = r.Images.Medium
+		v.Site = r.Publisher
+		v.Duration, _ = search.ParseClock(r.Duration)
+
+		// Dates are usually without a timezone, e.g.
+		// "2024-05-17T12:00:00.0000000".
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05.9999999"} {
+			if t, err := time.Parse(layout, r.Published); err == nil {
+				v.Published = &t
+				break
+			}
+		}
+	}
+
+	if v.Link == "" {
+		return v, false
+	}
+
+	v.Link = search.CleanURL(v.Link)
+	return v, true
+}
+
 // Ping checks to see if the engine is reachable.
 func (d *ddg) Ping(ctx context.Context) error {
 	// Just access the index to see if we're okay.
 	_, err := d.http.Get(ctx, "https://lite.duckduckgo.com/lite")
 	return err
 }
+
+func (d *ddg) Syntax() search.Syntax {
+	return search.DefaultSyntax
+}
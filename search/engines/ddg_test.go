@@ -1,8 +1,10 @@
 package engines
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"git.sr.ht/~cmcevoy/srchd/internal/engtest"
 	"git.sr.ht/~cmcevoy/srchd/search"
@@ -29,6 +31,33 @@ func TestDDGPageParams(t *testing.T) {
 	}
 }
 
+func TestDDGCategoryResult(t *testing.T) {
+	d := &ddg{name: "ddg"}
+
+	// Trimmed down response of v.js.
+	data := ddgResponse{}
+	err := json.Unmarshal([]byte(`{"results": [
+		{"content": "https://www.youtube.com/watch?v=abc", "title": "Video", "description": "A video.", "duration": "4:05", "published": "2024-05-17T12:00:00.0000000", "publisher": "YouTube", "images": {"medium": "https://example.com/thumb.jpg"}},
+		{"content": "", "title": "Nothing"}
+	]}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := d.toNativeResult(search.CategoryVideos, data.Results[0])
+	if !ok {
+		t.Fatalf("result was dropped")
+	}
+
+	if v.Link != "https://www.youtube.com/watch?v=abc" || v.Site != "YouTube" || v.Duration != 4*time.Minute+5*time.Second || v.Thumbnail == "" || v.Published == nil {
+		t.Errorf("unexpected result: %+v", v)
+	}
+
+	if _, ok := d.toNativeResult(search.CategoryVideos, data.Results[1]); ok {
+		t.Errorf("result without link was kept")
+	}
+}
+
 func TestDDGSearch(t *testing.T) {
 	engtest.New("ddg", search.Config{}).RunTests(t,
 		"hello world",
@@ -18,9 +18,25 @@ type google struct {
 }
 
 var (
-	_ search.Engine = &google{}
+	_ search.Engine         = &google{}
+	_ search.SyntaxEngine   = &google{}
+	_ search.CategoryEngine = &google{}
 )
 
+// Values of the tbs parameter for each time range.
+var googleTimeRanges = map[search.TimeRange]string{
+	search.TimeRangeDay:   "qdr:d",
+	search.TimeRangeWeek:  "qdr:w",
+	search.TimeRangeMonth: "qdr:m",
+	search.TimeRangeYear:  "qdr:y",
+}
+
+// Values of the tbm parameter for each category.
+var googleCategories = map[search.Category]string{
+	search.CategoryNews:   "nws",
+	search.CategoryVideos: "vid",
+}
+
 func init() {
 	search.Add("google", true, func(config search.Config) (search.Engine, error) {
 		// Use the Links user agent which is excempt from the
@@ -36,6 +52,10 @@ func init() {
 			http:  cli,
 			debug: config.Debug,
 		}, nil
+	}, search.Capabilities{
+		Paging:     true,
+		TimeRange:  true,
+		SafeSearch: true,
 	})
 }
 
@@ -95,7 +115,7 @@ func (g *google) parseGeneral(doc *goquery.Document, query string) ([]search.Res
 }
 
 // Search attempts to query the engine and returns a number of results.
-func (g *google) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (g *google) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
 	form.Set("q", query)
@@ -112,6 +132,37 @@ func (g *google) Search(ctx context.Context, query string, page int) ([]search.R
 	// sorts of problems and calling it a day.
 	form.Set("udm", "14")
 
+	return g.search(ctx, form, query, page, opts)
+}
+
+// Sets the parameters of a request from the search options.
+func setGoogleOptions(form url.Values, opts search.Options) {
+	if opts.Language != "" {
+		form.Set("hl", opts.Language)
+		form.Set("lr", "lang_"+opts.Language)
+	}
+
+	if opts.Region != "" {
+		form.Set("gl", opts.Region)
+	}
+
+	// Moderate is the default and has no parameter of its own.
+	switch opts.SafeSearch {
+	case search.SafeSearchOff:
+		form.Set("safe", "off")
+	case search.SafeSearchStrict:
+		form.Set("safe", "active")
+	}
+
+	if tbs, ok := googleTimeRanges[opts.TimeRange]; ok {
+		form.Set("tbs", tbs)
+	}
+}
+
+// Fetches and parses a results page.
+func (g *google) search(ctx context.Context, form url.Values, query string, page int, opts search.Options) ([]search.Result, error) {
+	setGoogleOptions(form, opts)
+
 	if page >= 1 {
 		form.Set("start", fmt.Sprint(page*10))
 	}
@@ -127,9 +178,37 @@ func (g *google) Search(ctx context.Context, query string, page int) ([]search.R
 	return g.parseGeneral(doc, query)
 }
 
+func (g *google) Categories() []search.Category {
+	return []search.Category{search.CategoryNews, search.CategoryVideos}
+}
+
+// SearchCategory attempts to query a category of the engine and returns a
+// number of results.
+func (g *google) SearchCategory(ctx context.Context, category search.Category, query string, page int, opts search.Options) ([]search.Result, error) {
+	tbm, ok := googleCategories[category]
+	if !ok {
+		return nil, fmt.Errorf("category %q is not supported", category)
+	}
+
+	form := url.Values{}
+
+	form.Set("q", query)
+	form.Set("ie", "UTF-8")
+
+	// The basic HTML version of news and video results is laid out the
+	// same as general results.
+	form.Set("tbm", tbm)
+
+	return g.search(ctx, form, query, page, opts)
+}
+
 // Ping checks to see if the engine is reachable.
 func (g *google) Ping(ctx context.Context) error {
 	// Just access the index to see if we're okay.
 	_, err := g.http.Get(ctx, "https://www.google.com/")
 	return err
 }
+
+func (g *google) Syntax() search.Syntax {
+	return search.DefaultSyntax
+}
@@ -22,7 +22,8 @@ type marginalia struct {
 }
 
 var (
-	_ search.Engine = &marginalia{}
+	_ search.Engine       = &marginalia{}
+	_ search.SyntaxEngine = &marginalia{}
 )
 
 func init() {
@@ -31,11 +32,17 @@ func init() {
 			name: config.Name,
 			http: config.NewHttpClient(),
 		}, nil
+	}, search.Capabilities{
+		Paging: true,
+
+		// Marginalia only indexes English websites, and has no region,
+		// safe search or time range filters.
+		Languages: []string{"en"},
 	})
 }
 
 // Search attempts to query the engine and returns a number of results.
-func (d *marginalia) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (d *marginalia) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	q := url.Values{}
 	q.Set("query", query)
 	if page >= 1 {
@@ -83,3 +90,13 @@ func (d *marginalia) Ping(ctx context.Context) error {
 	_, err := d.http.Get(ctx, "https://marginalia-search.com")
 	return err
 }
+
+func (d *marginalia) Syntax() search.Syntax {
+	// Marginalia has no OR and no way to exclude or filter by anything
+	// but words and sites.
+	return search.Syntax{
+		search.OpPhrase:  `"`,
+		search.OpExclude: "-",
+		search.OpSite:    "site:",
+	}
+}
@@ -21,35 +21,41 @@ var (
 	_ search.Engine = &mediawiki{}
 )
 
+// Settings of the mediawiki engine.
+type mediawikiSettings struct {
+	Endpoint string `yaml:"endpoint" required:"true" doc:"The MediaWiki API endpoint to use, e.g. https://en.wikipedia.org/w/api.php."`
+}
+
+// Validate checks that the endpoint is a usable URL.
+func (s *mediawikiSettings) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &search.SettingError{Key: "endpoint", Err: errors.New("expected an http or https URL")}
+	}
+	return nil
+}
+
 func init() {
 	// Default is false because this requires configuration
 	search.Add("mediawiki", false, func(config search.Config) (search.Engine, error) {
-		var ep string
-		var ok bool
-
-		if config.Extra == nil {
-			return nil, errors.New("no extra configuration despite being required")
-		}
-
-		if _, ok = config.Extra["endpoint"]; !ok {
-			return nil, errors.New("endpoint not specified")
-		}
-
-		if ep, ok = config.Extra["endpoint"].(string); !ok {
-			return nil, errors.New("endpoint is not a string")
-		}
-
-		// TODO: Is endpoint valid?
+		settings := config.Settings.(*mediawikiSettings)
 
 		return &mediawiki{
 			name:     config.Name,
-			endpoint: ep,
+			endpoint: settings.Endpoint,
 			http:     config.NewHttpClient(),
 		}, nil
+	}, search.Capabilities{
+		// The opensearch API has no offset.
+		// It also has no language, region, safe search or time range
+		// filters; the language is that of the wiki at the endpoint.
+		Paging:      false,
+		NeedsConfig: true,
+		Settings:    mediawikiSettings{},
 	})
 }
 
-func (w *mediawiki) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (w *mediawiki) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
 	if page > 1 {
@@ -79,18 +85,18 @@ func (w *mediawiki) Search(ctx context.Context, query string, page int) ([]searc
 	}
 
 	if len(wres) != 4 {
-		return nil, fmt.Errorf("expected %d arrays, got %d", 4, len(wres))
+		return nil, fmt.Errorf("%w: expected %d arrays, got %d", search.ErrParse, 4, len(wres))
 	}
 
 	// Ensure everything is as we expect
 	var titles, descriptions, links []any
 	var ok bool
 	if titles, ok = wres[1].([]any); !ok {
-		return nil, fmt.Errorf("expected []any in second field, got %T", wres[1])
+		return nil, fmt.Errorf("%w: expected []any in second field, got %T", search.ErrParse, wres[1])
 	} else if descriptions, ok = wres[2].([]any); !ok {
-		return nil, fmt.Errorf("expected []any in third field, got %T", wres[2])
+		return nil, fmt.Errorf("%w: expected []any in third field, got %T", search.ErrParse, wres[2])
 	} else if links, ok = wres[3].([]any); !ok {
-		return nil, fmt.Errorf("expected []any in fourth field, got %T", wres[3])
+		return nil, fmt.Errorf("%w: expected []any in fourth field, got %T", search.ErrParse, wres[3])
 	}
 
 	results := make([]search.Result, len(wres[1].([]any)))
@@ -99,17 +105,17 @@ func (w *mediawiki) Search(ctx context.Context, query string, page int) ([]searc
 
 		title, ok := titles[i].(string)
 		if !ok {
-			return nil, fmt.Errorf("result %d has invalid title type %T", i, titles[i])
+			return nil, fmt.Errorf("%w: result %d has invalid title type %T", search.ErrParse, i, titles[i])
 		}
 
 		desc, ok := descriptions[i].(string)
 		if !ok {
-			return nil, fmt.Errorf("result %d has invalid description type %T", i, descriptions[i])
+			return nil, fmt.Errorf("%w: result %d has invalid description type %T", search.ErrParse, i, descriptions[i])
 		}
 
 		link, ok := links[i].(string)
 		if !ok {
-			return nil, fmt.Errorf("result %d has invalid link type %T", i, links[i])
+			return nil, fmt.Errorf("%w: result %d has invalid link type %T", search.ErrParse, i, links[i])
 		}
 
 		// All good!
@@ -23,7 +23,8 @@ type wibyResult struct {
 }
 
 var (
-	_ search.Engine = &wiby{}
+	_ search.Engine       = &wiby{}
+	_ search.SyntaxEngine = &wiby{}
 )
 
 func init() {
@@ -32,6 +33,11 @@ func init() {
 			name: config.Name,
 			http: config.NewHttpClient(),
 		}, nil
+	}, search.Capabilities{
+		// Wiby has no region, safe search or time range filters, and
+		// only indexes English websites.
+		Paging:    true,
+		Languages: []string{"en"},
 	})
 }
 
@@ -48,7 +54,7 @@ func (w *wiby) toNativeResult(r wibyResult) search.Result {
 	}
 }
 
-func (w *wiby) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (w *wiby) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	// Wiby has a native API we can use.
 	// There's probably some encoding/json tomfoolery I could employ so we
 	// don't need an intermediate step, but whatever.
@@ -88,3 +94,11 @@ func (w *wiby) Ping(ctx context.Context) error {
 	_, err := w.http.Get(ctx, "https://wiby.me/")
 	return err
 }
+
+func (w *wiby) Syntax() search.Syntax {
+	// Wiby only understands exact phrases and excluded words.
+	return search.Syntax{
+		search.OpPhrase:  `"`,
+		search.OpExclude: "-",
+	}
+}
@@ -16,7 +16,8 @@ type yahoo struct {
 }
 
 var (
-	_ search.Engine = &yahoo{}
+	_ search.Engine       = &yahoo{}
+	_ search.SyntaxEngine = &yahoo{}
 )
 
 func init() {
@@ -25,6 +26,10 @@ func init() {
 			name: config.Name,
 			http: config.NewHttpClient(),
 		}, nil
+	}, search.Capabilities{
+		// Yahoo can only limit results to the past day, week or month,
+		// which are still applied; see yahooTimeRanges.
+		Paging: true,
 	})
 }
 
@@ -52,13 +57,29 @@ func decodeYahooHref(href string) string {
 	return newHref
 }
 
+// Values of the btf parameter for each time range.
+// Yahoo has no way to search the past year.
+var yahooTimeRanges = map[search.TimeRange]string{
+	search.TimeRangeDay:   "d",
+	search.TimeRangeWeek:  "w",
+	search.TimeRangeMonth: "m",
+}
+
 // Search attempts to query the engine and returns a number of results.
-func (b *yahoo) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (b *yahoo) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
 	form.Set("p", query)
 	form.Set("nojs", "1")
 
+	if opts.Language != "" {
+		form.Set("vl", "lang_"+opts.Language)
+	}
+
+	if btf, ok := yahooTimeRanges[opts.TimeRange]; ok {
+		form.Set("btf", btf)
+	}
+
 	if page >= 1 {
 		form.Set("b", fmt.Sprint(1+7*page))
 		form.Set("pz", "7")
@@ -116,3 +137,15 @@ func (b *yahoo) Ping(ctx context.Context) error {
 	_, err := b.http.Get(ctx, "https://search.yahoo.com/")
 	return err
 }
+
+func (b *yahoo) Syntax() search.Syntax {
+	// Yahoo has no intitle:.
+	return search.Syntax{
+		search.OpPhrase:      `"`,
+		search.OpExclude:     "-",
+		search.OpSite:        "site:",
+		search.OpExcludeSite: "-site:",
+		search.OpFileType:    "filetype:",
+		search.OpOr:          "OR",
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 
 	"github.com/PuerkitoBio/goquery"
 
@@ -17,7 +18,8 @@ type yandex struct {
 }
 
 var (
-	_ search.Engine = &yandex{}
+	_ search.Engine       = &yandex{}
+	_ search.SyntaxEngine = &yandex{}
 )
 
 func init() {
@@ -37,17 +39,41 @@ func init() {
 			name: config.Name,
 			http: cli,
 		}, nil
+	}, search.Capabilities{
+		// The site search has no safe search or time range.
+		Paging: true,
 	})
 }
 
+// Yandex region IDs of the regions that Yandex serves best.
+// Other regions use the default.
+var yandexRegions = map[string]string{
+	"BY": "149",
+	"DE": "96",
+	"FR": "124",
+	"GB": "102",
+	"KZ": "159",
+	"RU": "225",
+	"TR": "983",
+	"UA": "187",
+	"US": "84",
+}
+
+// Languages that the lang: operator of Yandex accepts.
+var yandexLanguages = []string{"be", "de", "en", "fr", "kk", "ru", "tr", "tt", "uk"}
+
 func (b *yandex) isCaptcha(doc *goquery.Document) bool {
 	return doc.Find("title").Text() == "Are you not a robot?"
 }
 
 // Search attempts to query the engine and returns a number of results.
-func (b *yandex) Search(ctx context.Context, query string, page int) ([]search.Result, error) {
+func (b *yandex) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
 	form := url.Values{}
 
+	if slices.Contains(yandexLanguages, opts.Language) {
+		query += " lang:" + opts.Language
+	}
+
 	form.Set("text", query)
 
 	// I have no idea what search box this is going to, but it's the first
@@ -55,7 +81,11 @@ func (b *yandex) Search(ctx context.Context, query string, page int) ([]search.R
 	form.Set("searchid", "1")
 
 	form.Set("web", "1") // search everywhere
-	form.Set("lr", "87")
+	if lr, ok := yandexRegions[opts.Region]; ok {
+		form.Set("lr", lr)
+	} else {
+		form.Set("lr", "87")
+	}
 	form.Set("frame", "1")
 
 	if page >= 1 {
@@ -107,3 +137,16 @@ func (b *yandex) Ping(ctx context.Context) error {
 	_, err := b.http.Get(ctx, "https://yandex.com/")
 	return err
 }
+
+func (b *yandex) Syntax() search.Syntax {
+	// Yandex has its own names for some operators.
+	// See https://yandex.com/support/search/how-to-search/search-operators.html
+	return search.Syntax{
+		search.OpPhrase:   `"`,
+		search.OpExclude:  "-",
+		search.OpSite:     "site:",
+		search.OpFileType: "mime:",
+		search.OpInTitle:  "title:",
+		search.OpOr:       "|",
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	nurl "net/url"
 	"sync"
@@ -36,8 +36,11 @@ type HttpClient struct {
 	// If UserAgent is empty, then [DefaultUserAgent] is used.
 	UserAgent string
 
-	// Debug logs all HTTP requests sent through this HttpClient if it is
-	// true before the first request is made.
+	// Debug logs all HTTP requests sent through this HttpClient at the
+	// info level instead of the debug level.
+	//
+	// Queries are redacted from logged URLs unless redaction was turned off
+	// with [SetRedactQueries].
 	Debug bool
 
 	// Send requests using this HTTP proxy.
@@ -46,7 +49,31 @@ type HttpClient struct {
 	// must be explicitly set to use a proxy for all HTTP requests.
 	HttpProxy string
 
+	// Spread requests across these proxies instead of HttpProxy.
+	HttpProxies []string
+
+	// Determines which proxy of HttpProxies a request is sent through.
+	//
+	// If ProxyStrategy is empty, [ProxyRoundRobin] is used.
+	ProxyStrategy ProxyStrategy
+
+	// Proxies that get a captcha or a 429 status code are not used for
+	// this long, unless all proxies are benched.
+	//
+	// If ProxyBench is 0, [DefaultProxyBench] is used.
+	ProxyBench time.Duration
+
+	// Authenticate to SOCKS proxies with this username, unless the proxy
+	// URL has one.
+	// Proxies such as Tor send connections with different credentials
+	// through different circuits, so clients with a different
+	// ProxyIsolation can't be linked to each other.
+	ProxyIsolation string
+
 	// Enable HTTP/3 using quic-go.
+	//
+	// None of the supported proxies can carry the UDP traffic of HTTP/3,
+	// so requests fail if a proxy is also set.
 	QUIC bool
 
 	// Enable zero roundtrip time for a performance boost on subsequent
@@ -63,6 +90,23 @@ type HttpClient struct {
 	// https://datatracker.ietf.org/doc/html/rfc8446#section-8
 	QUIC_0RTT bool
 
+	// Limits the number of searches sent to RequestsPerMinute, allowing
+	// bursts of up to Burst searches; see [HttpClient.Do].
+	// Searches over the limit fail with [ErrRateLimited] instead of
+	// waiting.
+	//
+	// If RequestsPerMinute is 0, the rate is not limited.
+	// If Burst is 0, it is 1.
+	RequestsPerMinute float64
+	Burst             int
+
+	// Limits the number of searches sent per day, resetting at midnight
+	// UTC.
+	// Searches over the budget fail with [ErrRateLimited].
+	//
+	// If DailyBudget is 0, there is no budget.
+	DailyBudget int
+
 	// Specify a cookie jar to use.
 	//
 	// If left nil, no cookies will be saved.
@@ -74,8 +118,11 @@ type HttpClient struct {
 	// The user agent is always set.
 	BaseHeaders http.Header
 
-	http *http.Client
-	once sync.Once
+	http    *http.Client
+	limiter *rateLimiter
+	pool    *proxyPool
+	err     error
+	once    sync.Once
 }
 
 // HttpError represents a generic HTTP error.
@@ -111,8 +158,10 @@ var (
 	_ io.ReadCloser = &lazyReader{}
 )
 
+// Error describes the failed request.
+// Queries are redacted from the URL; see [RedactURL].
 func (h HttpError) Error() string {
-	return fmt.Sprintf("%s %q failed with status code %d", h.Method, h.URL, h.Status)
+	return fmt.Sprintf("%s %q failed with status code %d", h.Method, RedactURL(h.URL), h.Status)
 }
 
 func newLazyReader(src io.ReadCloser, f func(src io.Reader) (io.Reader, error)) *lazyReader {
@@ -185,16 +234,32 @@ func handleResponseDecompression(res *http.Response) {
 	}
 }
 
+// HTTP/3 runs over UDP, which neither HTTP nor SOCKS proxies carry here;
+// sending it around the proxy would leak the address of the instance.
+var errQUICProxy = errors.New("quic cannot be used with a proxy: HTTP and SOCKS5 proxies can't carry UDP")
+
+// Creates the proxy pool from the proxy settings.
+func setupProxies(h *HttpClient) error {
+	proxies := h.HttpProxies
+	if len(proxies) == 0 && h.HttpProxy != "" {
+		proxies = []string{h.HttpProxy}
+	}
+
+	if h.QUIC && len(proxies) > 0 {
+		return errQUICProxy
+	}
+
+	var err error
+	h.pool, err = newProxyPool(proxies, h.ProxyStrategy, h.ProxyBench, h.ProxyIsolation)
+	return err
+}
+
 func setupTransport(h *HttpClient, hc *http.Client) {
 	var proxy func(*http.Request) (*nurl.URL, error)
 
-	if h.HttpProxy != "" {
-		proxyURL, err := nurl.Parse(h.HttpProxy)
-		if err != nil {
-			panic(err) // TODO
-		}
-
-		proxy = http.ProxyURL(proxyURL)
+	if h.pool != nil {
+		// Do picks the proxy of each request.
+		proxy = requestProxy
 	}
 
 	// This is ripped from http.DefaultTransport
@@ -231,6 +296,11 @@ func setupQUIC(h *HttpClient, hc *http.Client) {
 // Ensures that the HttpClient is ready to perform requests.
 func (h *HttpClient) ensureReady() {
 	h.once.Do(func() {
+		h.limiter = newRateLimiter(h.RequestsPerMinute, h.Burst, h.DailyBudget)
+
+		// Requests fail with this error instead.
+		h.err = setupProxies(h)
+
 		// Create a new HTTP client.
 		if h.http != nil {
 			return
@@ -295,6 +365,9 @@ func (h *HttpClient) quicMethod(method string) string {
 // New creates a new HTTP request.
 func (h *HttpClient) New(ctx context.Context, method, url string, body []byte, contentType ...string) (*http.Request, error) {
 	h.ensureReady()
+	if h.err != nil {
+		return nil, h.err
+	}
 
 	// Parse the URL. We need this for cookies.
 	parsedUrl, err := nurl.Parse(url)
@@ -334,6 +407,11 @@ func (h *HttpClient) New(ctx context.Context, method, url string, body []byte, c
 		}
 	}
 
+	// Ask for the language of the search, if there is one.
+	if lang := OptionsFromContext(ctx).AcceptLanguage(); lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
+
 	if body != nil {
 		req.Header.Set("Content-Type", contentType[0])
 		req.Header.Set("Content-Length", fmt.Sprint(len(body)))
@@ -349,13 +427,75 @@ func (h *HttpClient) New(ctx context.Context, method, url string, body []byte, c
 	return req, nil
 }
 
+// Do sends a request created with New.
+//
+// The first request of a search sent with [SearchCategory] is charged to the
+// rate limit and daily budget; other requests, including pings, are not.
+// If the rate limit or daily budget has been reached, the request is not sent
+// and the returned error wraps [ErrRateLimited].
+//
+// When using several proxies, the request is sent through the one picked by
+// ProxyStrategy; the proxy is benched if the response has a 429 status code.
 func (h *HttpClient) Do(req *http.Request) (*http.Response, error) {
+	h.ensureReady()
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	if err := h.limiter.takeSearch(req.Context()); err != nil {
+		return nil, err
+	}
+
+	trace := proxyTraceFromContext(req.Context())
+	proxy := h.pool.pick(trace.searchQuery())
+	if proxy != nil {
+		req = req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy))
+		trace.add(h.pool, proxy)
+	}
+
+	res, err := h.do(req)
+	if err == nil && res.StatusCode == http.StatusTooManyRequests {
+		h.pool.benchProxy(proxy)
+	}
+
+	return res, err
+}
+
+// Redacts the URL of every [*url.Error] in the tree of err.
+//
+// errors.As only finds the first one, but transports that send requests of
+// their own, such as proxies, wrap the errors of those too.
+func redactURLErrors(err error) {
+	switch e := err.(type) {
+	case nil:
+		return
+	case *nurl.Error:
+		e.URL = RedactURL(e.URL)
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		redactURLErrors(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, v := range e.Unwrap() {
+			redactURLErrors(v)
+		}
+	}
+}
+
+// Sends a request without taking it from the rate limit.
+func (h *HttpClient) do(req *http.Request) (*http.Response, error) {
+	level := slog.LevelDebug
 	if h.Debug {
-		log.Printf("requesting %v", req.URL)
+		level = slog.LevelInfo
 	}
+	Logger().Log(req.Context(), level, "sending request", "method", req.Method, "url", RedactURL(req.URL.String()))
 
 	res, err := h.http.Do(req)
 
+	// Errors of the HTTP client hold the full URL.
+	redactURLErrors(err)
+
 	// If we're using QUIC, then there's a possibility that the request
 	// failed, but it was a temporary failure that could be immediately
 	// retried.
@@ -367,7 +507,7 @@ func (h *HttpClient) Do(req *http.Request) (*http.Response, error) {
 			// amount of times we go here, so we don't hammer the
 			// server with requests if it keeps telling us
 			// NO_ERROR.
-			return h.Do(req)
+			return h.do(req)
 		}
 
 		// This space is intentionally left blank
@@ -433,10 +573,6 @@ func (h *HttpClient) Post(ctx context.Context, url string, contentType string, b
 	if res.StatusCode != 200 {
 		// The request itself succeeded but we aren't interested in
 		// anything we got due to the failure status.
-		if h.Debug {
-			log.Printf("post %s failed with status code %d", url, res.StatusCode)
-		}
-
 		return nil, HttpError{Status: res.StatusCode, URL: url, Method: "POST"}
 	}
 
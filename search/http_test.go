@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"compress/zlib"
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
@@ -152,3 +153,82 @@ func TestHttpClientCookies(t *testing.T) {
 		}
 	}
 }
+
+func TestHttpClientAcceptLanguage(t *testing.T) {
+	hc := &HttpClient{}
+
+	req, err := hc.New(context.Background(), "GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	if lang := req.Header.Get("Accept-Language"); lang != defaultBaseHeaders.Get("Accept-Language") {
+		t.Errorf("default Accept-Language is %q", lang)
+	}
+
+	ctx := withOptions(context.Background(), Options{Language: "de", Region: "AT"})
+	req, err = hc.New(ctx, "GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	if lang := req.Header.Get("Accept-Language"); lang != "de-AT,de;q=0.9" {
+		t.Errorf("Accept-Language with options is %q", lang)
+	}
+}
+
+func TestHttpClientRateLimit(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	e := &fetchEngine{http: &HttpClient{DailyBudget: 1}, url: srv.URL, requests: 2}
+
+	// Pings are never charged.
+	for range 3 {
+		if err := e.Ping(context.Background()); err != nil {
+			t.Fatalf("ping failed: %v", err)
+		}
+	}
+
+	// A search is charged once, however many requests it sends.
+	if _, err := SearchCategory(context.Background(), e, CategoryWeb, "test", 0, Options{}); err != nil {
+		t.Fatalf("first search failed: %v", err)
+	}
+
+	if _, err := SearchCategory(context.Background(), e, CategoryWeb, "test", 0, Options{}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second search: err = %v, want %v", err, ErrRateLimited)
+	}
+
+	if requests != 5 {
+		t.Errorf("server got %d requests, want 5", requests)
+	}
+}
+
+// An engine that sends a number of requests to a URL per search.
+type fetchEngine struct {
+	http     *HttpClient
+	url      string
+	requests int
+}
+
+func (e *fetchEngine) Ping(ctx context.Context) error {
+	res, err := e.http.Get(ctx, e.url)
+	if err == nil {
+		res.Body.Close()
+	}
+	return err
+}
+
+func (e *fetchEngine) Search(ctx context.Context, query string, page int, opts Options) ([]Result, error) {
+	for range e.requests {
+		res, err := e.http.Get(ctx, e.url)
+		if err != nil {
+			return nil, err
+		}
+		res.Body.Close()
+	}
+	return nil, nil
+}
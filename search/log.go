@@ -0,0 +1,76 @@
+package search
+
+import (
+	"log/slog"
+	nurl "net/url"
+	"sync/atomic"
+)
+
+// The value that replaces redacted parts of URLs.
+const redacted = "REDACTED"
+
+var logger atomic.Pointer[slog.Logger]
+
+// Whether queries are left in URLs; the zero value redacts them.
+var showQueries atomic.Bool
+
+// SetLogger sets the logger used by engines and [HttpClient].
+//
+// By default, or if l is nil, [slog.Default] is used.
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Logger returns the logger used by engines and [HttpClient].
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
+
+// SetRedactQueries determines whether [RedactURL] removes queries from URLs.
+//
+// Queries are redacted by default.
+func SetRedactQueries(redact bool) {
+	showQueries.Store(!redact)
+}
+
+// RedactURL replaces the values of the query string and the fragment of a URL
+// with "REDACTED", so that URLs can be logged without revealing what was
+// searched for.
+//
+// The names of query parameters are kept, since they help with debugging and
+// never hold the query themselves.
+// Passwords are always removed.
+//
+// If redaction was turned off with [SetRedactQueries], only the password is
+// removed.
+// If the URL cannot be parsed, it is replaced entirely.
+func RedactURL(url string) string {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return redacted
+	}
+
+	if showQueries.Load() {
+		return u.Redacted()
+	}
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for _, v := range q {
+			for i := range v {
+				v[i] = redacted
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	if u.Fragment != "" {
+		u.Fragment = redacted
+		u.RawFragment = ""
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SafeSearch is a level of filtering of explicit results.
+type SafeSearch string
+
+// Supported safe search levels.
+const (
+	SafeSearchOff      SafeSearch = "off"
+	SafeSearchModerate SafeSearch = "moderate"
+	SafeSearchStrict   SafeSearch = "strict"
+)
+
+// SafeSearchLevels holds all safe search levels, from least to most strict.
+var SafeSearchLevels = []SafeSearch{SafeSearchOff, SafeSearchModerate, SafeSearchStrict}
+
+// TimeRange limits results to those published recently.
+type TimeRange string
+
+// Supported time ranges.
+const (
+	TimeRangeDay   TimeRange = "day"
+	TimeRangeWeek  TimeRange = "week"
+	TimeRangeMonth TimeRange = "month"
+	TimeRangeYear  TimeRange = "year"
+)
+
+// TimeRanges holds all time ranges, from shortest to longest.
+var TimeRanges = []TimeRange{TimeRangeDay, TimeRangeWeek, TimeRangeMonth, TimeRangeYear}
+
+// Options changes how an engine performs a search.
+//
+// The zero value of every field means that the engine should use its own
+// default.
+// Engines map the options to their own parameters as best as they can, and
+// ignore those they have no equivalent for.
+type Options struct {
+	// Language of the results as a lowercase ISO 639-1 code, e.g. "en".
+	Language string `json:"language,omitempty"`
+
+	// Region of the results as an uppercase ISO 3166-1 alpha-2 code,
+	// e.g. "US".
+	Region string `json:"region,omitempty"`
+
+	// SafeSearch determines how explicit results are filtered.
+	SafeSearch SafeSearch `json:"safe_search,omitempty"`
+
+	// TimeRange limits the results to those published within the range.
+	TimeRange TimeRange `json:"time_range,omitempty"`
+}
+
+// Determines if s is made of n to m ASCII letters.
+func isLetters(s string, n, m int) bool {
+	if len(s) < n || len(s) > m {
+		return false
+	}
+
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Normalize returns the options with the language and region in their
+// canonical case, e.g. "EN" and "us" become "en" and "US".
+func (o Options) Normalize() Options {
+	o.Language = strings.ToLower(o.Language)
+	o.Region = strings.ToUpper(o.Region)
+	return o
+}
+
+// Validate checks that all options hold a known value.
+func (o Options) Validate() error {
+	if o.Language != "" && !isLetters(o.Language, 2, 3) {
+		return fmt.Errorf("invalid language %q", o.Language)
+	}
+
+	if o.Region != "" && !isLetters(o.Region, 2, 2) {
+		return fmt.Errorf("invalid region %q", o.Region)
+	}
+
+	if o.SafeSearch != "" && !slices.Contains(SafeSearchLevels, o.SafeSearch) {
+		return fmt.Errorf("invalid safe search level %q", o.SafeSearch)
+	}
+
+	if o.TimeRange != "" && !slices.Contains(TimeRanges, o.TimeRange) {
+		return fmt.Errorf("invalid time range %q", o.TimeRange)
+	}
+
+	return nil
+}
+
+// Locale returns the language and region as a BCP 47 tag, e.g. "en-US".
+//
+// If only one of the language or region is set, only that one is returned.
+func (o Options) Locale() string {
+	switch {
+	case o.Language != "" && o.Region != "":
+		return o.Language + "-" + o.Region
+	case o.Language != "":
+		return o.Language
+	default:
+		return o.Region
+	}
+}
+
+// AcceptLanguage returns the value of an Accept-Language header for the
+// language and region, or an empty string if there is no language.
+func (o Options) AcceptLanguage() string {
+	if o.Language == "" {
+		return ""
+	}
+
+	if o.Region == "" {
+		return o.Language
+	}
+
+	return fmt.Sprintf("%s,%s;q=0.9", o.Locale(), o.Language)
+}
+
+// String returns a stable representation of the options, suitable for use as
+// a key.
+func (o Options) String() string {
+	return fmt.Sprintf("lang=%s region=%s safe=%s time=%s", o.Language, o.Region, o.SafeSearch, o.TimeRange)
+}
+
+type optionsKey struct{}
+
+// Attaches options to a context.
+//
+// [HttpClient] uses these to set headers such as Accept-Language.
+func withOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// OptionsFromContext returns the options of the search that ctx belongs to.
+func OptionsFromContext(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts  Options
+		valid bool
+	}{
+		{Options{}, true},
+		{Options{Language: "en", Region: "US", SafeSearch: SafeSearchStrict, TimeRange: TimeRangeWeek}, true},
+		{Options{Language: "english"}, false},
+		{Options{Language: "e1"}, false},
+		{Options{Region: "USA"}, false},
+		{Options{SafeSearch: "maximum"}, false},
+		{Options{TimeRange: "decade"}, false},
+	}
+
+	for _, v := range tests {
+		t.Run(v.opts.String(), func(t *testing.T) {
+			if err := v.opts.Validate(); (err == nil) != v.valid {
+				t.Errorf("Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestOptionsAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		opts Options
+		out  string
+	}{
+		{Options{}, ""},
+		{Options{Region: "US"}, ""},
+		{Options{Language: "de"}, "de"},
+		{Options{Language: "EN", Region: "gb"}.Normalize(), "en-GB,en;q=0.9"},
+	}
+
+	for _, v := range tests {
+		t.Run(v.opts.String(), func(t *testing.T) {
+			if res := v.opts.AcceptLanguage(); res != v.out {
+				t.Errorf("%q != %q", res, v.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	nurl "net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ProxyStrategy determines which proxy of a pool a request is sent through.
+type ProxyStrategy string
+
+// Supported proxy strategies.
+const (
+	// Every request uses the next proxy in turn.
+	ProxyRoundRobin ProxyStrategy = "round-robin"
+
+	// Every request uses a random proxy.
+	ProxyRandom ProxyStrategy = "random"
+
+	// All requests of a search use the same proxy, picked by the query.
+	ProxySticky ProxyStrategy = "sticky"
+)
+
+// ProxyStrategies holds all proxy strategies.
+var ProxyStrategies = []ProxyStrategy{ProxyRoundRobin, ProxyRandom, ProxySticky}
+
+// Default amount of time a proxy is benched for.
+const DefaultProxyBench = time.Minute * 10
+
+// ProxyStat describes the health of a proxy used by an engine.
+type ProxyStat struct {
+	// URL of the proxy, without a password.
+	URL string
+
+	// Number of requests sent through the proxy.
+	Requests int
+
+	// Number of times the proxy was benched.
+	Failures int
+
+	// If the proxy is benched, the time at which it will be used again.
+	BenchedUntil time.Time
+}
+
+// Benched determines if the proxy is currently not being used.
+func (p ProxyStat) Benched() bool {
+	return time.Now().Before(p.BenchedUntil)
+}
+
+// A proxy of a [proxyPool].
+type poolProxy struct {
+	url *nurl.URL
+
+	mu           sync.Mutex
+	requests     int
+	failures     int
+	benchedUntil time.Time
+}
+
+// proxyPool spreads requests across several proxies.
+//
+// Proxies that get an engine to return a captcha or a 429 status code are
+// benched, and are not used until the bench time has passed unless every
+// proxy is benched.
+//
+// A nil *proxyPool is valid and sends requests without a proxy.
+type proxyPool struct {
+	strategy ProxyStrategy
+	bench    time.Duration
+	proxies  []*poolProxy
+
+	mu   sync.Mutex
+	next int
+}
+
+type proxyKey struct{}
+
+// Records the proxies used by a search.
+type proxyTrace struct {
+	query string
+
+	mu   sync.Mutex
+	used []*poolProxy
+	pool *proxyPool
+}
+
+type proxyTraceKey struct{}
+
+// Schemes of supported proxies.
+//
+// SOCKS5 proxies always resolve hostnames themselves, so "socks5" is the
+// same as "socks5h" and DNS queries never leak around the proxy.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// Parses a proxy URL.
+func parseProxyURL(proxy string) (*nurl.URL, error) {
+	u, err := nurl.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: expected scheme://host:port", proxy)
+	}
+
+	if !slices.Contains(proxySchemes, u.Scheme) {
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %q", proxy, u.Scheme)
+	}
+
+	return u, nil
+}
+
+// Determines if a proxy is a SOCKS proxy.
+func isSOCKS(u *nurl.URL) bool {
+	return u.Scheme == "socks5" || u.Scheme == "socks5h"
+}
+
+// Creates a new proxy pool.
+//
+// If there are no proxies, newProxyPool returns nil.
+// If bench is not positive, [DefaultProxyBench] is used.
+// If isolation is not empty, it is used as the username of SOCKS proxies that
+// have none; see [HttpClient.ProxyIsolation].
+func newProxyPool(proxies []string, strategy ProxyStrategy, bench time.Duration, isolation string) (*proxyPool, error) {
+	if len(proxies) == 0 {
+		return nil, nil
+	}
+
+	if strategy == "" {
+		strategy = ProxyRoundRobin
+	} else if !slices.Contains(ProxyStrategies, strategy) {
+		return nil, fmt.Errorf("unknown proxy strategy %q", strategy)
+	}
+
+	if bench <= 0 {
+		bench = DefaultProxyBench
+	}
+
+	p := &proxyPool{
+		strategy: strategy,
+		bench:    bench,
+	}
+
+	for _, v := range proxies {
+		u, err := parseProxyURL(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if isolation != "" && isSOCKS(u) && u.User == nil {
+			u.User = nurl.User(isolation)
+		}
+
+		p.proxies = append(p.proxies, &poolProxy{url: u})
+	}
+
+	return p, nil
+}
+
+// Picks the proxy to send a request through.
+//
+// query is used by [ProxySticky]; if it is empty, the next proxy in turn is
+// used instead.
+func (p *proxyPool) pick(query string) *poolProxy {
+	if p == nil {
+		return nil
+	}
+
+	now := time.Now()
+	healthy := make([]*poolProxy, 0, len(p.proxies))
+	for _, v := range p.proxies {
+		v.mu.Lock()
+		if !now.Before(v.benchedUntil) {
+			healthy = append(healthy, v)
+		}
+		v.mu.Unlock()
+	}
+
+	if len(healthy) == 0 {
+		// Sending the request through a benched proxy is still better
+		// than not sending it at all.
+		healthy = p.proxies
+	}
+
+	var proxy *poolProxy
+	switch {
+	case p.strategy == ProxyRandom:
+		proxy = healthy[rand.IntN(len(healthy))]
+	case p.strategy == ProxySticky && query != "":
+		h := fnv.New32a()
+		h.Write([]byte(query))
+		proxy = healthy[h.Sum32()%uint32(len(healthy))]
+	default:
+		p.mu.Lock()
+		proxy = healthy[p.next%len(healthy)]
+		p.next++
+		p.mu.Unlock()
+	}
+
+	proxy.mu.Lock()
+	proxy.requests++
+	proxy.mu.Unlock()
+
+	return proxy
+}
+
+// Stops using a proxy for the bench time of the pool.
+func (p *proxyPool) benchProxy(proxy *poolProxy) {
+	if p == nil || proxy == nil {
+		return
+	}
+
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+
+	proxy.failures++
+	proxy.benchedUntil = time.Now().Add(p.bench)
+}
+
+// Returns the health of every proxy in the pool.
+func (p *proxyPool) stats() []ProxyStat {
+	if p == nil {
+		return nil
+	}
+
+	out := make([]ProxyStat, len(p.proxies))
+	for i, v := range p.proxies {
+		v.mu.Lock()
+		out[i] = ProxyStat{
+			URL:          v.url.Redacted(),
+			Requests:     v.requests,
+			Failures:     v.failures,
+			BenchedUntil: v.benchedUntil,
+		}
+		v.mu.Unlock()
+	}
+
+	return out
+}
+
+// Returns the proxy a request was assigned by [HttpClient.Do].
+//
+// This is used as the Proxy function of the transport.
+func requestProxy(req *http.Request) (*nurl.URL, error) {
+	proxy, _ := req.Context().Value(proxyKey{}).(*poolProxy)
+	if proxy == nil {
+		return nil, nil
+	}
+
+	return proxy.url, nil
+}
+
+// Attaches a proxy trace for a search to a context.
+func withProxyTrace(ctx context.Context, query string) (context.Context, *proxyTrace) {
+	trace := &proxyTrace{query: query}
+	return context.WithValue(ctx, proxyTraceKey{}, trace), trace
+}
+
+// Returns the proxy trace of a context, or nil if there is none.
+func proxyTraceFromContext(ctx context.Context) *proxyTrace {
+	trace, _ := ctx.Value(proxyTraceKey{}).(*proxyTrace)
+	return trace
+}
+
+// Returns the query of the search that ctx belongs to, if any.
+func (t *proxyTrace) searchQuery() string {
+	if t == nil {
+		return ""
+	}
+	return t.query
+}
+
+// Records that a request of the search used a proxy.
+func (t *proxyTrace) add(pool *proxyPool, proxy *poolProxy) {
+	if t == nil || proxy == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pool = pool
+	if !slices.Contains(t.used, proxy) {
+		t.used = append(t.used, proxy)
+	}
+}
+
+// Benches the proxies used by a search if err shows they are no longer
+// welcome.
+func (t *proxyTrace) finish(err error) {
+	if t == nil || !errors.Is(err, ErrCaptcha) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, v := range t.used {
+		t.pool.benchProxy(v)
+	}
+}
+
+var clients = map[string]*HttpClient{}
+var clientsMu sync.Mutex
+
+// Remembers the client of an engine for [ProxyStats].
+func registerClient(name string, h *HttpClient) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients[name] = h
+}
+
+// ProxyStats returns the health of the proxies used by an engine, or nil if
+// the engine doesn't use a proxy.
+//
+// Only clients created with [Config.NewHttpClient] are known.
+func ProxyStats(name string) []ProxyStat {
+	clientsMu.Lock()
+	h := clients[name]
+	clientsMu.Unlock()
+
+	if h == nil {
+		return nil
+	}
+
+	h.ensureReady()
+	return h.pool.stats()
+}
@@ -0,0 +1,232 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyPoolInvalid(t *testing.T) {
+	if _, err := newProxyPool([]string{"http://127.0.0.1:8080", "::"}, "", 0, ""); err == nil {
+		t.Errorf("invalid proxy URL was accepted")
+	}
+
+	if _, err := newProxyPool([]string{"http://127.0.0.1:8080"}, "fastest", 0, ""); err == nil {
+		t.Errorf("unknown strategy was accepted")
+	}
+
+	if _, err := (Config{Type: "dummy", HttpProxy: "127.0.0.1:8080"}).New(); err == nil {
+		t.Errorf("engine with invalid proxy was initialized")
+	}
+}
+
+func TestProxyPoolStrategies(t *testing.T) {
+	proxies := []string{"http://a.example:1", "http://b.example:1", "http://c.example:1"}
+
+	p, _ := newProxyPool(proxies, ProxyRoundRobin, 0, "")
+	for i := range 6 {
+		if got := p.pick("").url.String(); got != proxies[i%3] {
+			t.Errorf("round robin pick %d = %s, want %s", i, got, proxies[i%3])
+		}
+	}
+
+	p, _ = newProxyPool(proxies, ProxySticky, 0, "")
+	first := p.pick("hello world")
+	for range 5 {
+		if got := p.pick("hello world"); got != first {
+			t.Errorf("sticky pick changed from %s to %s", first.url, got.url)
+		}
+	}
+
+	// Benched proxies are skipped until every proxy is benched.
+	p, _ = newProxyPool(proxies, ProxyRoundRobin, 0, "")
+	p.benchProxy(p.proxies[0])
+	p.benchProxy(p.proxies[1])
+	for range 3 {
+		if got := p.pick(""); got != p.proxies[2] {
+			t.Errorf("picked benched proxy %s", got.url)
+		}
+	}
+
+	p.benchProxy(p.proxies[2])
+	if p.pick("") == nil {
+		t.Errorf("no proxy picked when all are benched")
+	}
+}
+
+func TestHttpClientProxyBench(t *testing.T) {
+	// Requests for http:// URLs are sent to the proxy as-is, so any
+	// server will do.
+	var hits [2]int
+	newProxy := func(i, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+			w.WriteHeader(status)
+		}))
+	}
+
+	limited := newProxy(0, http.StatusTooManyRequests)
+	defer limited.Close()
+	ok := newProxy(1, http.StatusOK)
+	defer ok.Close()
+
+	hc := &HttpClient{HttpProxies: []string{limited.URL, ok.URL}}
+	for range 4 {
+		res, err := hc.Get(context.Background(), "http://engine.example/")
+		if err == nil {
+			res.Body.Close()
+		}
+	}
+
+	if hits[0] != 1 || hits[1] != 3 {
+		t.Errorf("proxy hits = %v, want [1 3]", hits)
+	}
+
+	stats := hc.pool.stats()
+	if !stats[0].Benched() || stats[0].Failures != 1 || stats[1].Requests != 3 {
+		t.Errorf("unexpected proxy stats: %+v", stats)
+	}
+}
+
+func TestSearchCategoryBenchesProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	hc := &HttpClient{HttpProxy: srv.URL}
+	eng := &captchaEngine{http: hc}
+
+	SearchCategory(context.Background(), eng, CategoryWeb, "hello", 0, Options{})
+
+	if stats := hc.pool.stats(); !stats[0].Benched() {
+		t.Errorf("proxy was not benched: %+v", stats[0])
+	}
+}
+
+// An engine that sends one request and always finds a captcha.
+type captchaEngine struct {
+	http *HttpClient
+}
+
+func (c *captchaEngine) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *captchaEngine) Search(ctx context.Context, query string, page int, opts Options) ([]Result, error) {
+	res, err := c.http.Get(ctx, "http://engine.example/")
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return nil, ErrCaptcha
+}
+
+// Runs a minimal SOCKS5 server that answers every request with "ok".
+//
+// The username and destination host of the last connection are sent on the
+// returned channel.
+func serveSOCKS5(t *testing.T) (string, <-chan [2]string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan [2]string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				read := func(n int) []byte {
+					buf := make([]byte, n)
+					io.ReadFull(r, buf)
+					return buf
+				}
+
+				// Greeting; prefer username/password if offered.
+				methods := read(int(read(2)[1]))
+				method := byte(0)
+				if bytes.IndexByte(methods, 2) != -1 {
+					method = 2
+				}
+				conn.Write([]byte{5, method})
+
+				user := ""
+				if method == 2 {
+					user = string(read(int(read(2)[1])))
+					read(int(read(1)[0]))
+					conn.Write([]byte{1, 0})
+				}
+
+				// Connect request; only domain names are accepted,
+				// which is the point.
+				req := read(4)
+				if req[3] != 3 {
+					conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				host := string(read(int(read(1)[0])))
+				read(2)
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				ch <- [2]string{user, host}
+
+				if _, err := http.ReadRequest(r); err != nil {
+					return
+				}
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"))
+			}()
+		}
+	}()
+
+	return l.Addr().String(), ch
+}
+
+func TestHttpClientSOCKS5(t *testing.T) {
+	addr, ch := serveSOCKS5(t)
+
+	for _, scheme := range []string{"socks5", "socks5h"} {
+		hc := &HttpClient{HttpProxy: scheme + "://" + addr, ProxyIsolation: "google"}
+
+		res, err := hc.Get(context.Background(), "http://engine.example/")
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", scheme, err)
+		}
+		res.Body.Close()
+
+		// The hostname must be resolved by the proxy.
+		if got := <-ch; got != [2]string{"google", "engine.example"} {
+			t.Errorf("%s: proxy got user and host %q", scheme, got)
+		}
+	}
+}
+
+func TestConfigProxyErrors(t *testing.T) {
+	tests := []Config{
+		{Type: "dummy", HttpProxy: "ftp://127.0.0.1:21"},
+		{Type: "dummy", HttpProxies: []string{"socks5://127.0.0.1:9050", "socks4://127.0.0.1:9050"}},
+		{Type: "dummy", QUIC: true, HttpProxy: "socks5h://127.0.0.1:9050"},
+		{Type: "dummy", QUIC: true, HttpProxies: []string{"http://127.0.0.1:3128"}},
+	}
+
+	for _, v := range tests {
+		if _, err := v.New(); err == nil {
+			t.Errorf("engine with proxy %q %v (quic = %v) was initialized", v.HttpProxy, v.HttpProxies, v.QUIC)
+		}
+	}
+
+	if _, err := (Config{Type: "dummy", QUIC: true, HttpProxy: "-"}).New(); err != nil {
+		t.Errorf("quic without a proxy failed: %v", err)
+	}
+}
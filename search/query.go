@@ -0,0 +1,318 @@
+package search
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Operator is a search operator that may be used in a query.
+type Operator string
+
+// Supported search operators.
+const (
+	// "exact phrase"
+	OpPhrase Operator = "phrase"
+
+	// -term or -"exact phrase"
+	OpExclude Operator = "exclude"
+
+	// site:example.com
+	OpSite Operator = "site"
+
+	// -site:example.com
+	OpExcludeSite Operator = "-site"
+
+	// filetype:pdf
+	OpFileType Operator = "filetype"
+
+	// intitle:term
+	OpInTitle Operator = "intitle"
+
+	// term OR term
+	OpOr Operator = "or"
+)
+
+// Syntax describes the operators an engine understands natively and how the
+// engine expects them to be written.
+//
+// For [OpPhrase], the value is the quotation mark to surround phrases with.
+// For [OpOr], the value is the word placed between alternatives.
+// For all other operators, the value is the prefix of the term.
+//
+// Operators that are missing are removed from queries given to the engine.
+type Syntax map[Operator]string
+
+// DefaultSyntax is the syntax understood by most major search engines.
+var DefaultSyntax = Syntax{
+	OpPhrase:      `"`,
+	OpExclude:     "-",
+	OpSite:        "site:",
+	OpExcludeSite: "-site:",
+	OpFileType:    "filetype:",
+	OpInTitle:     "intitle:",
+	OpOr:          "OR",
+}
+
+// SyntaxEngine is an optional interface that an [Engine] can implement to
+// declare the search operators it supports.
+//
+// An engine that does not implement SyntaxEngine will only ever receive
+// plain words.
+type SyntaxEngine interface {
+	Engine
+
+	// Syntax returns the operators that the engine supports.
+	Syntax() Syntax
+}
+
+// Term is a single part of a [Query].
+type Term struct {
+	// Op is the operator of this term; it is empty for plain words.
+	Op Operator
+
+	// Value is the word, phrase or argument of the operator.
+	// It is empty for [OpOr].
+	Value string
+}
+
+// Query is a parsed search query.
+type Query struct {
+	Terms []Term
+}
+
+// Prefixes of operators that take an argument, in the form they are written
+// by users.
+var operatorPrefixes = []struct {
+	prefix string
+	op     Operator
+}{
+	{"-site:", OpExcludeSite},
+	{"site:", OpSite},
+	{"filetype:", OpFileType},
+	{"intitle:", OpInTitle},
+}
+
+// Splits a query into tokens, keeping quoted phrases together.
+//
+// The quotes are kept in the returned tokens.
+func tokenize(query string) []string {
+	toks := []string{}
+	tok := strings.Builder{}
+	quoted := false
+
+	for _, r := range query {
+		if r == '"' {
+			quoted = !quoted
+		}
+
+		if unicode.IsSpace(r) && !quoted {
+			if tok.Len() > 0 {
+				toks = append(toks, tok.String())
+				tok.Reset()
+			}
+			continue
+		}
+
+		tok.WriteRune(r)
+	}
+
+	if tok.Len() > 0 {
+		toks = append(toks, tok.String())
+	}
+
+	return toks
+}
+
+// Removes the surrounding quotes of a phrase.
+//
+// An unterminated phrase is accepted.
+func unquote(s string) (string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, false
+	}
+
+	s = strings.TrimPrefix(s, `"`)
+	s = strings.TrimSuffix(s, `"`)
+	return s, true
+}
+
+// ParseQuery parses a search query.
+//
+// ParseQuery never fails; anything that isn't a valid operator is treated as
+// a plain word.
+func ParseQuery(query string) Query {
+	q := Query{}
+
+	for _, tok := range tokenize(query) {
+		q.Terms = append(q.Terms, parseTerm(tok))
+	}
+
+	return q
+}
+
+// Parses a single token of a query.
+func parseTerm(tok string) Term {
+	if tok == "OR" || tok == "|" {
+		return Term{Op: OpOr}
+	}
+
+	lower := strings.ToLower(tok)
+	for _, v := range operatorPrefixes {
+		if !strings.HasPrefix(lower, v.prefix) || len(tok) == len(v.prefix) {
+			continue
+		}
+
+		val, _ := unquote(tok[len(v.prefix):])
+		if val == "" {
+			break
+		}
+		return Term{Op: v.op, Value: val}
+	}
+
+	if val, ok := unquote(tok); ok && val != "" {
+		return Term{Op: OpPhrase, Value: val}
+	}
+
+	if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+		val, _ := unquote(tok[1:])
+		if val != "" {
+			return Term{Op: OpExclude, Value: val}
+		}
+	}
+
+	return Term{Value: tok}
+}
+
+// Operators returns all operators used in the query.
+func (q Query) Operators() []Operator {
+	ops := []Operator{}
+	for _, t := range q.Terms {
+		if t.Op != "" && !slices.Contains(ops, t.Op) {
+			ops = append(ops, t.Op)
+		}
+	}
+	return ops
+}
+
+// Unsupported returns the operators used in the query that are not in syntax.
+func (q Query) Unsupported(syntax Syntax) []Operator {
+	return slices.DeleteFunc(q.Operators(), func(op Operator) bool {
+		_, ok := syntax[op]
+		return ok
+	})
+}
+
+// Format writes the query using an engine's syntax.
+//
+// Operators that the engine doesn't support are removed, with the exception
+// of phrases and titles whose words are kept as plain words.
+// The returned string is empty if nothing is left of the query.
+func (q Query) Format(syntax Syntax) string {
+	parts := []string{}
+
+	quote := func(s string) string {
+		if !strings.ContainsFunc(s, unicode.IsSpace) {
+			return s
+		}
+		return syntax[OpPhrase] + s + syntax[OpPhrase]
+	}
+
+	for i, t := range q.Terms {
+		v, ok := syntax[t.Op]
+
+		switch {
+		case t.Op == "":
+			parts = append(parts, t.Value)
+		case t.Op == OpPhrase && ok:
+			parts = append(parts, v+t.Value+v)
+		case t.Op == OpPhrase || t.Op == OpInTitle && !ok:
+			// The words are still useful on their own.
+			parts = append(parts, t.Value)
+		case t.Op == OpOr:
+			// Only useful between two other terms.
+			if ok && i > 0 && i < len(q.Terms)-1 {
+				parts = append(parts, v)
+			}
+		case ok:
+			parts = append(parts, v+quote(t.Value))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// String writes the query using [DefaultSyntax].
+func (q Query) String() string {
+	return q.Format(DefaultSyntax)
+}
+
+// Determines if a link is on a site as given to the site: operator.
+//
+// The site may either be a hostname, which also matches its subdomains, or a
+// hostname followed by a path.
+func onSite(u *url.URL, site string) bool {
+	host := strings.ToLower(u.Hostname())
+	site = strings.ToLower(site)
+	site = strings.TrimPrefix(site, "https://")
+	site = strings.TrimPrefix(site, "http://")
+
+	siteHost, sitePath, _ := strings.Cut(site, "/")
+
+	if host != siteHost && !strings.HasSuffix(host, "."+siteHost) {
+		return false
+	}
+
+	return sitePath == "" || strings.HasPrefix(strings.TrimPrefix(u.Path, "/"), sitePath)
+}
+
+// Match determines if a result satisfies the terms of the query that use any
+// of the operators in ops.
+//
+// Not all operators can be checked this way; phrases, OR and plain words are
+// always considered to match, as the title and description of a result
+// rarely hold all of the text of the page.
+// If a query has several site: terms, a result must only match one of them.
+func (q Query) Match(res Result, ops []Operator) bool {
+	u, err := url.Parse(res.Link)
+	if err != nil {
+		return false
+	}
+
+	text := strings.ToLower(res.Title + " " + res.Description)
+	sites := 0
+	onAnySite := false
+
+	for _, t := range q.Terms {
+		if !slices.Contains(ops, t.Op) {
+			continue
+		}
+
+		val := strings.ToLower(t.Value)
+
+		switch t.Op {
+		case OpSite:
+			sites++
+			onAnySite = onAnySite || onSite(u, t.Value)
+		case OpExcludeSite:
+			if onSite(u, t.Value) {
+				return false
+			}
+		case OpFileType:
+			if !strings.HasSuffix(strings.ToLower(u.Path), "."+strings.TrimPrefix(val, ".")) {
+				return false
+			}
+		case OpInTitle:
+			if !strings.Contains(strings.ToLower(res.Title), val) {
+				return false
+			}
+		case OpExclude:
+			if strings.Contains(text, val) {
+				return false
+			}
+		}
+	}
+
+	return sites == 0 || onAnySite
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []Term
+	}{
+		{"hello world", []Term{{Value: "hello"}, {Value: "world"}}},
+		{`"hello world" test`, []Term{{Op: OpPhrase, Value: "hello world"}, {Value: "test"}}},
+		{`"unterminated phrase`, []Term{{Op: OpPhrase, Value: "unterminated phrase"}}},
+		{"-spam eggs", []Term{{Op: OpExclude, Value: "spam"}, {Value: "eggs"}}},
+		{`-"spam eggs"`, []Term{{Op: OpExclude, Value: "spam eggs"}}},
+		{"go site:go.dev", []Term{{Value: "go"}, {Op: OpSite, Value: "go.dev"}}},
+		{"go -site:example.com", []Term{{Value: "go"}, {Op: OpExcludeSite, Value: "example.com"}}},
+		{"paper filetype:pdf", []Term{{Value: "paper"}, {Op: OpFileType, Value: "pdf"}}},
+		{`intitle:"go wiki"`, []Term{{Op: OpInTitle, Value: "go wiki"}}},
+		{"Site:go.dev", []Term{{Op: OpSite, Value: "go.dev"}}},
+		{"cats OR dogs", []Term{{Value: "cats"}, {Op: OpOr}, {Value: "dogs"}}},
+		{"cats or dogs", []Term{{Value: "cats"}, {Value: "or"}, {Value: "dogs"}}},
+		{"site: - https://example.com", []Term{{Value: "site:"}, {Value: "-"}, {Value: "https://example.com"}}},
+	}
+
+	for _, v := range tests {
+		t.Run(v.in, func(t *testing.T) {
+			res := ParseQuery(v.in)
+			if !reflect.DeepEqual(res.Terms, v.out) {
+				t.Errorf("%#v != %#v", res.Terms, v.out)
+			}
+		})
+	}
+}
+
+func TestQueryFormat(t *testing.T) {
+	yandex := Syntax{
+		OpPhrase:   `"`,
+		OpFileType: "mime:",
+		OpOr:       "|",
+	}
+
+	tests := []struct {
+		in     string
+		syntax Syntax
+		out    string
+	}{
+		{`"hello world" -spam site:go.dev`, DefaultSyntax, `"hello world" -spam site:go.dev`},
+		{`intitle:"go wiki" filetype:pdf`, DefaultSyntax, `intitle:"go wiki" filetype:pdf`},
+		{`"hello world" -spam site:go.dev`, nil, "hello world"},
+		{`intitle:wiki go`, nil, "wiki go"},
+		{"paper filetype:pdf", yandex, "paper mime:pdf"},
+		{"cats OR dogs", yandex, "cats | dogs"},
+		{"cats OR dogs", nil, "cats dogs"},
+		{"OR cats", DefaultSyntax, "cats"},
+		{"site:go.dev", nil, ""},
+	}
+
+	for _, v := range tests {
+		t.Run(v.in, func(t *testing.T) {
+			res := ParseQuery(v.in).Format(v.syntax)
+			if res != v.out {
+				t.Errorf("%q != %q", res, v.out)
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	res := Result{
+		Link:        "https://docs.example.com/guide/intro.pdf",
+		Title:       "Introduction to Widgets",
+		Description: "Everything you need to know about widgets.",
+	}
+
+	tests := []struct {
+		in    string
+		match bool
+	}{
+		{"widgets", true},
+		{"site:example.com", true},
+		{"site:docs.example.com/guide", true},
+		{"site:example.com/blog", false},
+		{"site:example.org", false},
+		{"site:example.org site:example.com", true},
+		{"-site:example.com", false},
+		{"filetype:pdf", true},
+		{"filetype:html", false},
+		{"intitle:widgets", true},
+		{"intitle:gadgets", false},
+		{"-gadgets", true},
+		{"-know", false},
+		{`"not in the description"`, true},
+	}
+
+	for _, v := range tests {
+		t.Run(v.in, func(t *testing.T) {
+			q := ParseQuery(v.in)
+			if q.Match(res, q.Operators()) != v.match {
+				t.Errorf("Match = %v, want %v", !v.match, v.match)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiter limits the number of requests sent to an engine with a token
+// bucket and an optional daily budget.
+//
+// A nil *rateLimiter is valid and never limits anything.
+type rateLimiter struct {
+	// Tokens added to the bucket per second.
+	rate float64
+
+	// Size of the bucket.
+	burst float64
+
+	// Maximum number of requests per day; 0 means no budget.
+	budget int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	used   int
+	day    time.Time
+}
+
+// Creates a new rate limiter.
+//
+// If perMinute is not positive, requests are only limited by the budget.
+// If burst is not positive, it defaults to 1.
+// If neither perMinute nor budget is positive, newRateLimiter returns nil
+// which disables limiting altogether.
+func newRateLimiter(perMinute float64, burst, budget int) *rateLimiter {
+	if perMinute <= 0 && budget <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:   perMinute / 60,
+		burst:  float64(burst),
+		budget: budget,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Takes a token from the bucket and a request from the budget.
+//
+// If either is exhausted, take returns an error wrapping [ErrRateLimited] and
+// takes nothing.
+// Requests are never queued; waiting for a token would only hold up the
+// search.
+func (r *rateLimiter) take() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	// Budgets reset at midnight UTC.
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(r.day) {
+		r.day = day
+		r.used = 0
+	}
+
+	if r.budget > 0 && r.used >= r.budget {
+		return fmt.Errorf("%w: daily budget of %d requests used up", ErrRateLimited, r.budget)
+	}
+
+	if r.rate > 0 {
+		r.tokens = min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+		r.last = now
+
+		if r.tokens < 1 {
+			wait := time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+			return fmt.Errorf("%w: next request allowed in %v", ErrRateLimited, wait.Round(time.Second))
+		}
+
+		r.tokens--
+	}
+
+	r.used++
+	return nil
+}
+
+type searchChargeKey struct{}
+
+// Marks a context as belonging to a single search, which is charged to the
+// rate limit of an engine once however many requests it sends.
+func withSearchCharge(ctx context.Context) context.Context {
+	return context.WithValue(ctx, searchChargeKey{}, &atomic.Bool{})
+}
+
+// Takes a token and a request from the budget for the search that ctx belongs
+// to, unless the search has already been charged.
+//
+// Requests that don't belong to a search, such as pings, are never charged.
+func (r *rateLimiter) takeSearch(ctx context.Context) error {
+	charged, ok := ctx.Value(searchChargeKey{}).(*atomic.Bool)
+	if r == nil || !ok || charged.Swap(true) {
+		return nil
+	}
+
+	if err := r.take(); err != nil {
+		charged.Store(false)
+		return err
+	}
+	return nil
+}
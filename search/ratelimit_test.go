@@ -0,0 +1,53 @@
+package search
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	r := newRateLimiter(60, 2, 0)
+
+	for i := range 2 {
+		if err := r.take(); err != nil {
+			t.Fatalf("request %d limited: %v", i, err)
+		}
+	}
+
+	if err := r.take(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("burst exceeded: err = %v", err)
+	}
+
+	// One request per second.
+	r.last = r.last.Add(-time.Second)
+	if err := r.take(); err != nil {
+		t.Errorf("token not refilled: %v", err)
+	}
+}
+
+func TestRateLimiterBudget(t *testing.T) {
+	r := newRateLimiter(0, 0, 2)
+
+	for i := range 2 {
+		if err := r.take(); err != nil {
+			t.Fatalf("request %d limited: %v", i, err)
+		}
+	}
+
+	if err := r.take(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("budget exceeded: err = %v", err)
+	}
+
+	// A new day, a new budget.
+	r.day = r.day.Add(-24 * time.Hour)
+	if err := r.take(); err != nil {
+		t.Errorf("budget not reset: %v", err)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	if r := newRateLimiter(0, 5, 0); r != nil {
+		t.Errorf("expected nil limiter, got %+v", r)
+	}
+}
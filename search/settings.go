@@ -0,0 +1,235 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting describes an engine-specific setting, as declared by the struct
+// given in [Capabilities.Settings].
+//
+// Each exported field of the struct is a setting.
+// The key of a setting is taken from the yaml tag of its field, its
+// documentation from the doc tag, and a `required:"true"` tag makes it
+// required.
+// The value of the field in the struct given to [Add] is its default.
+type Setting struct {
+	// Key of the setting in the configuration of the engine.
+	Key string `json:"key"`
+
+	// Type of the value, e.g. "string" or "list of strings".
+	Type string `json:"type"`
+
+	// Default value, formatted for display; empty if there is none.
+	Default string `json:"default,omitempty"`
+
+	// Required is true if the engine can't be used without the setting.
+	Required bool `json:"required,omitempty"`
+
+	// Doc describes the setting.
+	Doc string `json:"doc,omitempty"`
+}
+
+// SettingError is returned by [Config.New] when an engine-specific setting is
+// invalid.
+type SettingError struct {
+	// Key of the setting.
+	Key string
+
+	// Line of the setting in the configuration file, or 0 if unknown.
+	Line int
+
+	Err error
+}
+
+func (e *SettingError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: setting %q: %v", e.Line, e.Key, e.Err)
+	}
+	return fmt.Sprintf("setting %q: %v", e.Key, e.Err)
+}
+
+func (e *SettingError) Unwrap() error {
+	return e.Err
+}
+
+// Validator may be implemented by the settings struct of an engine to check
+// settings beyond their types once they have been decoded.
+//
+// Validate should return a [*SettingError] naming the offending setting.
+type Validator interface {
+	Validate() error
+}
+
+// Returns the key of a settings field, or "" if it is not a setting.
+func settingKey(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		// The default of the YAML decoder.
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// Describes the type of a setting for people.
+func settingType(t reflect.Type) string {
+	if t == reflect.TypeFor[time.Duration]() {
+		return "duration"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "list of " + settingType(t.Elem()) + "s"
+	case reflect.Map:
+		return "map of " + settingType(t.Elem()) + "s"
+	default:
+		return t.String()
+	}
+}
+
+// SettingsOf returns the engine-specific settings that engines of a type
+// accept, in the order they are declared.
+func SettingsOf(driverType string) []Setting {
+	def := capabilities[driverType].Settings
+	if def == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(def)
+	t := v.Type()
+
+	out := []Setting{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		key := settingKey(f)
+		if key == "" {
+			continue
+		}
+
+		s := Setting{
+			Key:      key,
+			Type:     settingType(f.Type),
+			Required: f.Tag.Get("required") == "true",
+			Doc:      f.Tag.Get("doc"),
+		}
+		if fv := v.Field(i); !fv.IsZero() {
+			s.Default = fmt.Sprint(fv.Interface())
+		}
+
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// Returns the value of a key of a mapping node, or nil if there is no such
+// key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Returns the engine-specific part of the configuration as a mapping node.
+//
+// The node the configuration was decoded from is used if there is one, so
+// errors can point at the right line; otherwise, Extra is encoded.
+func (c Config) settingsNode() (*yaml.Node, error) {
+	if c.node == nil {
+		node := &yaml.Node{}
+		if err := node.Encode(c.Extra); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(c.node.Content); i += 2 {
+		if !slices.Contains(ConfigKeys(), c.node.Content[i].Value) {
+			node.Content = append(node.Content, c.node.Content[i], c.node.Content[i+1])
+		}
+	}
+	return node, nil
+}
+
+// Decodes the engine-specific settings of an engine of a type into a copy of
+// the defaults the engine declared.
+//
+// Returns nil if the engine has no settings.
+// Keys that are not settings are ignored; see [Config.UnknownSettings].
+func (c Config) decodeSettings(driverType string) (any, error) {
+	def := capabilities[driverType].Settings
+	if def == nil {
+		return nil, nil
+	}
+
+	ptr := reflect.New(reflect.TypeOf(def))
+	ptr.Elem().Set(reflect.ValueOf(def))
+	v := ptr.Elem()
+	t := v.Type()
+
+	node, err := c.settingsNode()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		key := settingKey(f)
+		if key == "" {
+			continue
+		}
+
+		value := mappingValue(node, key)
+		if value == nil {
+			if f.Tag.Get("required") == "true" {
+				return nil, &SettingError{Key: key, Err: fmt.Errorf("required but not set")}
+			}
+			continue
+		}
+
+		if err := value.Decode(v.Field(i).Addr().Interface()); err != nil {
+			return nil, &SettingError{Key: key, Line: value.Line, Err: fmt.Errorf("expected %s", settingType(f.Type))}
+		}
+	}
+
+	if val, ok := ptr.Interface().(Validator); ok {
+		if err := val.Validate(); err != nil {
+			// Point at the setting if the engine named it.
+			var serr *SettingError
+			if errors.As(err, &serr) && serr.Line == 0 {
+				if value := mappingValue(node, serr.Key); value != nil {
+					serr.Line = value.Line
+				}
+			}
+			return nil, err
+		}
+	}
+
+	return ptr.Interface(), nil
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type testSettings struct {
+	Endpoint string        `yaml:"endpoint" required:"true" doc:"Where to send requests."`
+	Retries  int           `yaml:"retries" doc:"How often to retry."`
+	Wait     time.Duration `yaml:"wait"`
+	Tags     []string      `yaml:"tags"`
+}
+
+func (s *testSettings) Validate() error {
+	if s.Retries < 0 {
+		return &SettingError{Key: "retries", Err: errors.New("must not be negative")}
+	}
+	return nil
+}
+
+func init() {
+	Add("settings", false, func(config Config) (Engine, error) {
+		return &dummyEngine{name: config.Name}, nil
+	}, Capabilities{Settings: testSettings{Retries: 3}})
+}
+
+func TestSettingsOf(t *testing.T) {
+	expected := []Setting{
+		{Key: "endpoint", Type: "string", Required: true, Doc: "Where to send requests."},
+		{Key: "retries", Type: "integer", Default: "3", Doc: "How often to retry."},
+		{Key: "wait", Type: "duration"},
+		{Key: "tags", Type: "list of strings"},
+	}
+
+	if got := SettingsOf("settings"); !slices.Equal(got, expected) {
+		t.Errorf("SettingsOf() = %+v", got)
+	}
+
+	if got := SettingsOf("dummy"); got != nil {
+		t.Errorf("SettingsOf() = %+v for an engine without settings", got)
+	}
+}
+
+func TestConfigSettings(t *testing.T) {
+	tests := []struct {
+		data string
+		line int
+		key  string
+	}{
+		{"type: settings\nendpoint: x\nwait: 5s\ntags: [a, b]\n", 0, ""},
+		{"type: settings\nretries: 1\n", 0, "endpoint"},
+		{"type: settings\nendpoint: x\nretries: many\n", 3, "retries"},
+		{"type: settings\nendpoint: x\n\nretries: -1\n", 4, "retries"},
+	}
+
+	for _, v := range tests {
+		var c Config
+		if err := yaml.Unmarshal([]byte(v.data), &c); err != nil {
+			t.Fatal(err)
+		}
+		c.Name = "test"
+
+		_, err := c.New()
+		if v.key == "" {
+			if err != nil {
+				t.Errorf("config %q: %v", v.data, err)
+			}
+			continue
+		}
+
+		var serr *SettingError
+		if !errors.As(err, &serr) {
+			t.Errorf("config %q: expected a SettingError, got %v", v.data, err)
+			continue
+		}
+
+		if serr.Key != v.key || serr.Line != v.line {
+			t.Errorf("config %q: error for %q at line %d, expected %q at line %d", v.data, serr.Key, serr.Line, v.key, v.line)
+		}
+	}
+}
+
+func TestConfigSettingsDecoded(t *testing.T) {
+	c := Config{
+		Type:  "settings",
+		Extra: map[string]any{"endpoint": "x", "tags": []any{"a"}},
+	}
+
+	settings, err := c.decodeSettings("settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := settings.(*testSettings)
+	if s.Endpoint != "x" || s.Retries != 3 || !slices.Equal(s.Tags, []string{"a"}) {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+}
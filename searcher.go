@@ -1,26 +1,29 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"slices"
-	"sort"
 	"strings"
 	"sync"
 	"time"
 	"unicode/utf8"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
+	"golang.org/x/sync/singleflight"
 )
 
 const maxTitleLen = 100
 const maxDescriptionLen = 300
 
-var engines = map[string]search.Engine{}
+// Searches of engines that are currently running, keyed by [cacheKey].
+var inflight singleflight.Group
 var errAllFailed = errors.New("no engines performed a query successfully")
+var errTimedOut = errors.New("timed out (partial results)")
+var errNoEngines = errors.New("no engines are able to perform this search")
 
 // Determines the default set of requested engines from the request.
 //
@@ -37,11 +40,12 @@ func findWantedEngines(r *http.Request) []string {
 	return strings.Split(strings.TrimSpace(cookie.Value), ",")
 }
 
-// Handles the ':' search operator which specifies specific engines to search.
-func processOperators(query string) (requestedEngines []string, newQuery string) {
+// Handles the ':' search operator which specifies specific engines or groups
+// to search, and its negated form ":-" which excludes them.
+func processOperators(query string) (requestedEngines, excludedEngines []string, newQuery string) {
 	if !strings.ContainsRune(query, ':') {
 		// No colon operator, so nothing to change.
-		return nil, query
+		return nil, nil, query
 	}
 
 	toks := strings.Split(query, " ")
@@ -49,6 +53,9 @@ func processOperators(query string) (requestedEngines []string, newQuery string)
 	for i, tok := range toks {
 		if strings.HasPrefix(tok, "\\:") {
 			toks[i] = tok[1:] // Remove the backslash
+		} else if strings.HasPrefix(tok, ":-") && len(tok) > 2 {
+			toks[i] = ""
+			excludedEngines = append(excludedEngines, tok[2:])
 		} else if strings.HasPrefix(tok, ":") {
 			// Just set it to a blank string.
 			// This should change nothing with a search query.
@@ -61,6 +68,36 @@ func processOperators(query string) (requestedEngines []string, newQuery string)
 	return
 }
 
+// Replaces the names of groups in names with the engines in each group.
+//
+// Names that aren't groups are assumed to be engines and are kept as-is.
+func expandGroups(names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		members, ok := cfg().Groups[name]
+		if !ok {
+			members = []string{name}
+		}
+
+		for _, v := range members {
+			if !slices.Contains(out, v) {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// Returns the names of all configured groups in a stable order.
+func groupNames() []string {
+	names := make([]string, 0, len(cfg().Groups))
+	for name := range cfg().Groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
 // Normalizes a link by passing it through [net/url].
 func normalizeLink(link string) string {
 	purl, err := url.Parse(link)
@@ -76,35 +113,28 @@ func normalizeLink(link string) string {
 	return purl.String()
 }
 
+// Returns the weight of an engine as set in its configuration.
+func engineWeight(name string) float64 {
+	// Override the default value if there was one set.
+	engineConfig, ok := cfg().Engines[name]
+	if ok && engineConfig.Weight != 0 {
+		return engineConfig.Weight
+	}
+
+	return 1
+}
+
 // Calculates the multiplier of the result score.
 func calculateWeight(res search.Result) float64 {
 	sum := 0.0
 
 	for _, name := range res.Sources {
-		val := 1.0
-
-		// Override the above value if there was one set.
-		engineConfig, ok := cfg.Engines[name]
-		if ok {
-			// Ensure the weight is 1.
-			val = engineConfig.Weight
-			if val == 0 {
-				val = 1
-			}
-		}
-
-		sum += val
+		sum += engineWeight(name)
 	}
 
 	return sum
 }
 
-// Calculates the score to sort against.
-func calculateSortingScore(res search.Result) float64 {
-	weight := calculateWeight(res)
-	return weight * res.Score
-}
-
 // Truncates a string to n letters.
 func truncate(s string, n int) string {
 	if len(s) <= n || utf8.RuneCountInString(s) <= n {
@@ -125,147 +155,446 @@ func truncate(s string, n int) string {
 	panic("unreachable")
 }
 
-// Merges and sorts results.
-func processResults(res []search.Result) []search.Result {
-	// Track the first time we see a link and move stuff around.
-	firstSeen := map[string]int{}
+// Rewrites the links of results and ensures all fields are proper.
+//
+// Links are otherwise left as the engine returned them; see [canonicalLink]
+// for how duplicates are found.
+//
+// Results that have been removed by a rewrite rule are dropped.
+// The returned slice shares memory with res.
+func prepareResults(res []search.Result) []search.Result {
+	out := res[:0]
 
-	for i := 0; i < len(res); i++ {
-		link := rewriteUrl(normalizeLink(res[i].Link))
+	for _, v := range res {
+		link := rewriteUrl(v.Link)
 		if link == "" {
 			// Drop this result because it's invalid OR was
 			// explicitly removed (replace: "").
 			// TODO: What's a good way to move forward with this?
 			// Just log it?
-			res[i], res[len(res)-1] = res[len(res)-1], res[i]
-			res = res[:len(res)-1]
-			i-- // retry
-
 			continue
 		}
 
 		// Update link. TODO: Move this out of here, maybe.
-		res[i].Link = link
+		v.Link = link
 
-		idx, ok := firstSeen[link]
-		if !ok {
-			// First occurrence.
-			firstSeen[link] = i
-			res[i].Score = 1
+		v.Title = truncate(v.Title, maxTitleLen)
+		v.Description = truncate(v.Description, maxDescriptionLen)
 
-			// Ensure all fields are proper before we continue.
-			res[i].Title = truncate(res[i].Title, maxTitleLen)
-			res[i].Description = truncate(res[i].Description, maxDescriptionLen)
-			continue
-		}
+		out = append(out, v)
+	}
+
+	return out
+}
+
+// Merges and sorts the results of each engine using ranker.
+// If ranker is nil, the configured ranker is used.
+//
+// The slices in results are modified.
+func processResults(results map[string][]search.Result, ranker Ranker) []search.Result {
+	for name, res := range results {
+		results[name] = prepareResults(res)
+	}
+
+	if ranker == nil {
+		ranker = rankerByName(cfg().Ranking)
+	}
+
+	return collapseNearDuplicates(ranker.Rank(results), cfg().NearDuplicateThreshold)
+}
+
+// The outcome of searching a single engine.
+type engineResponse struct {
+	// Name of the engine.
+	Name string
+
+	// Results returned by the engine with the blacklist applied.
+	Results []search.Result
 
-		// Add in the engine source(s).
-		// Technically there's only supposed to be one, so this may be unnecessary.
-		for _, name := range res[i].Sources {
-			if !slices.Contains(res[idx].Sources, name) {
-				res[idx].Sources = append(res[idx].Sources, name)
+	// Err is non-nil if the search failed.
+	Err error
+}
+
+// Returns the operators that an engine supports natively.
+func engineSyntax(e search.Engine) search.Syntax {
+	if se, ok := e.(search.SyntaxEngine); ok {
+		return se.Syntax()
+	}
+	return nil
+}
+
+// Returns the capabilities of an initialized engine.
+func engineCapabilities(name string) search.Capabilities {
+	return search.CapabilitiesOf(engineType(name), current().engines[name])
+}
+
+// Returns the operators used in query that at least one of the named engines
+// of st can't handle natively.
+func unsupportedOperators(st *instance, query search.Query, names []string) []search.Operator {
+	ops := []search.Operator{}
+	for _, name := range names {
+		for _, op := range query.Unsupported(engineSyntax(st.engines[name])) {
+			if !slices.Contains(ops, op) {
+				ops = append(ops, op)
 			}
 		}
+	}
+	return ops
+}
+
+// A search to perform on a single engine.
+type engineRequest struct {
+	Category search.Category
 
-		// If we're missing text, replace it with this.
-		if res[idx].Title == "" {
-			res[idx].Title = truncate(res[i].Title, maxTitleLen)
+	// Query formatted using the syntax of the engine.
+	Query string
+
+	Page    int
+	Options search.Options
+}
+
+// Searches a single engine, consulting the cache first.
+//
+// Identical searches of an engine that run at the same time share a single
+// request to the engine.
+// Suspended engines are not searched and return an error wrapping
+// errSuspended.
+func searchEngine(ctx context.Context, st *instance, name string, e search.Engine, req engineRequest) engineResponse {
+	// Try the cache first.
+	key := cacheKey(name, req)
+	if res, ok := st.cache.Get(key); ok {
+		engineCacheLookups.Inc(name, "hit")
+
+		res, _ = st.blacklist.Filter(res)
+		return engineResponse{Name: name, Results: res}
+	} else if st.cache != nil {
+		engineCacheLookups.Inc(name, "miss")
+	}
+
+	// Results that will be cached are worth waiting for even if the
+	// search goes away; the engine's own timeout still applies.
+	// Otherwise, the request is cancelled along with the search that
+	// started it.
+	fetchCtx := ctx
+	if st.cache != nil {
+		fetchCtx = context.WithoutCancel(ctx)
+	}
+
+	var v any
+	var err error
+	for i := 0; ; i++ {
+		ran := false
+		v, err, _ = inflight.Do(key, func() (any, error) {
+			ran = true
+			return fetchEngine(fetchCtx, st, name, e, req, key)
+		})
+		if !ran && i == 0 {
+			engineCoalesced.Inc(name)
 		}
-		if res[idx].Description == "" {
-			res[idx].Description = truncate(res[i].Description, maxDescriptionLen)
+
+		if ran || !errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			break
 		}
 
-		// Swap with the last element and shrink the slice.
-		res[i], res[len(res)-1] = res[len(res)-1], res[i]
-		res = res[:len(res)-1]
+		// The search that started the shared request went away, but
+		// this one didn't; start over.
+	}
 
-		// Increment the score.
-		// This is for sorting; results seen several times will appear
-		// higher in the search results.
-		res[idx].Score++
+	if err != nil {
+		return engineResponse{Name: name, Err: err}
+	}
 
-		// Decrement i so we can try the next element.
-		i--
+	// Every search gets its own copy of shared results.
+	return engineResponse{Name: name, Results: cloneResults(v.([]search.Result))}
+}
+
+// Sends a search to an engine and caches the results.
+//
+// The returned results have the blacklist applied.
+func fetchEngine(ctx context.Context, st *instance, name string, e search.Engine, req engineRequest, key string) ([]search.Result, error) {
+	// Leave engines that keep failing alone for a while.
+	breaker := engineBreaker(name)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
 	}
 
-	// Sort based upon the score.
-	sort.Slice(res, func(i, j int) bool {
-		// > is used so the results are descending and not ascending.
-		return calculateSortingScore(res[i]) > calculateSortingScore(res[j])
-	})
+	then := time.Now()
+	res, err := search.SearchCategory(ctx, e, req.Category, req.Query, req.Page, req.Options)
+	recordEngineRequest(name, time.Since(then), len(res), err)
+	breaker.Record(err)
+
+	if err != nil {
+		logSearch.Warn("search failed", "engine", name, "err", err)
+
+		return nil, err
+	}
 
-	// Return the (modified) slice.
-	return res
+	// Record the position of each result for ranking.
+	for i := range res {
+		res[i].Rank = i + 1
+	}
+
+	// Cache the raw results; the blacklist is applied to cached results
+	// on retrieval.
+	st.cache.Put(key, res)
+
+	// Apply the blacklist to the results and record the before & after
+	// count.
+	engineResults.Add(float64(len(res)), name)
+	res, n := st.blacklist.Filter(res)
+	engineDropped.Add(float64(n), name)
+
+	return res, nil
 }
 
-// Searches all requested engines.
-func doSearch(r *http.Request, requestQuery string, page int) ([]search.Result, map[string]error, error) {
+// Parameters of a search request.
+type searchParams struct {
+	// Query as entered by the user, including any operators.
+	Query string
+
+	// Page number, starting at 0.
+	Page int
+
+	// Category to search; if empty, [search.CategoryWeb] is searched.
+	Category search.Category
+
+	// Options given to every engine.
+	Options search.Options
+
+	// Names of the engines and groups to search unless the query picks
+	// its own.
+	// If empty, all engines are searched.
+	Engines []string
+
+	// Maximum amount of time to wait for engines to respond.
+	// Engines that take longer are reported as timed out and the results
+	// of all other engines are returned.
+	//
+	// Zero waits for all engines.
+	Timeout time.Duration
+
+	// Ranker used to merge the results of all engines.
+	// If nil, the configured ranker is used.
+	Ranker Ranker
+}
+
+// An in-flight search across several engines.
+type pendingSearch struct {
+	// Names of all engines being searched.
+	engines []string
+
+	// Receives the response of each engine; see [searchEngines].
+	ch <-chan engineResponse
+
+	timeout time.Duration
+
+	// The parsed query.
+	query search.Query
+
+	// Operators of the query that some engine didn't understand, which
+	// must be checked by [pendingSearch.filter].
+	unsupported []search.Operator
+}
+
+// Searches all requested engines concurrently.
+//
+// The response of each engine is sent on the returned channel as soon as it
+// is available, and the channel is closed once every engine has responded.
+// If wantEngines is empty, all engines are searched; engines in
+// excludeEngines and engines that don't support the category, page or
+// language are never searched.
+// The query is formatted using the syntax of each engine; engines that would
+// be left with an empty query are skipped.
+// The Query field of req is ignored.
+func searchEngines(ctx context.Context, st *instance, wantEngines, excludeEngines []string, query search.Query, req engineRequest) (<-chan engineResponse, []string) {
 	wg := sync.WaitGroup{}
 
-	wantEngines, query := processOperators(requestQuery)
+	// The channel is buffered so that engines never block on a reader
+	// that has gone away.
+	ch := make(chan engineResponse, len(st.engines))
+	names := []string{}
+
+	for name, eng := range st.engines {
+		if len(wantEngines) > 0 && !slices.Contains(wantEngines, name) {
+			continue
+		}
+
+		if slices.Contains(excludeEngines, name) || !search.Supports(eng, req.Category) {
+			continue
+		}
+
+		// Engines without more pages would only repeat themselves, and
+		// engines without results in the language have nothing to add.
+		caps := search.CapabilitiesOf(engineType(name), eng)
+		if !caps.SupportsPage(req.Page) || !caps.SupportsLanguage(req.Options.Language) {
+			continue
+		}
+
+		req := req
+		req.Query = query.Format(engineSyntax(eng))
+		if req.Query == "" {
+			// Nothing this engine can search for.
+			continue
+		}
+
+		names = append(names, name)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch <- searchEngine(ctx, st, name, eng, req)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	return ch, names
+}
+
+// Parses a search query and searches all requested engines.
+//
+// The search is carried out by the running instance, even if a new one is
+// swapped in before it is done.
+func startSearch(ctx context.Context, params searchParams) (*pendingSearch, error) {
+	st := current()
+
+	wantEngines, excludeEngines, rawQuery := processOperators(params.Query)
+	query := search.ParseQuery(rawQuery)
+
+	// Engines picked in the query replace the user's default set.
+	if len(wantEngines) == 0 {
+		wantEngines = params.Engines
+	}
+	wantEngines = expandGroups(wantEngines)
+	excludeEngines = expandGroups(excludeEngines)
 
-	if len(query) == 0 {
+	if len(query.Terms) == 0 {
 		// Empty queries are likely an error.
-		return nil, nil, fmt.Errorf("empty query")
+		return nil, fmt.Errorf("empty query")
 	}
 
-	var errors map[string]error
-	results := []search.Result{}
-	mu := sync.Mutex{}
+	if params.Timeout > 0 && st.cache != nil {
+		// Engines that miss the deadline can still fill the cache, so
+		// don't cancel them when the request is done.
+		// Every engine has its own timeout, so they won't run forever.
+		ctx = context.WithoutCancel(ctx)
+	}
 
-	// Called as a goroutine for all requested engines in the loop below.
-	fn := func(name string, e search.Engine) {
-		defer wg.Done()
+	req := engineRequest{
+		Category: params.Category,
+		Page:     params.Page,
+		Options:  params.Options,
+	}
+	if req.Category == "" {
+		req.Category = search.CategoryWeb
+	}
 
-		then := time.Now()
-		res, err := e.Search(r.Context(), query, page)
-		dur := time.Since(then)
-		recordEngineReqTime(name, dur)
+	ch, names := searchEngines(ctx, st, wantEngines, excludeEngines, query, req)
+	if len(names) == 0 {
+		return nil, errNoEngines
+	}
 
-		mu.Lock()
-		defer mu.Unlock()
+	return &pendingSearch{
+		engines:     names,
+		ch:          ch,
+		timeout:     params.Timeout,
+		query:       query,
+		unsupported: unsupportedOperators(st, query, names),
+	}, nil
+}
 
-		if err != nil {
-			if errors == nil {
-				// Lazily initialize the map.
-				// In most cases, there will be no errors so
-				// there's no point in allocating it.
-				errors = map[string]error{}
+// Removes results that don't satisfy the operators of the query that were
+// not understood by every engine.
+//
+// The returned slice shares memory with res.
+func (p *pendingSearch) filter(res []search.Result) []search.Result {
+	if len(p.unsupported) == 0 {
+		return res
+	}
+
+	return slices.DeleteFunc(res, func(v search.Result) bool {
+		return !p.query.Match(v, p.unsupported)
+	})
+}
+
+// Calls fn with the response of every engine as it arrives.
+//
+// If the timeout of the search passes before all engines have responded, fn
+// is called for each remaining engine with [errTimedOut] and the responses
+// that arrive afterwards are discarded.
+// If fn returns false, collect returns immediately.
+func (p *pendingSearch) collect(fn func(engineResponse) bool) {
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// Engines that haven't responded yet.
+	waiting := slices.Clone(p.engines)
+
+	for {
+		select {
+		case resp, ok := <-p.ch:
+			if !ok {
+				return
 			}
 
-			incrementEngineErrorCount(name)
-			errors[name] = err
-			log.Printf("searching %q failed: %v", name, err)
+			waiting = slices.DeleteFunc(waiting, func(name string) bool {
+				return name == resp.Name
+			})
 
+			if !fn(resp) {
+				return
+			}
+		case <-timeout:
+			for _, name := range waiting {
+				if !fn(engineResponse{Name: name, Err: errTimedOut}) {
+					return
+				}
+			}
 			return
 		}
+	}
+}
 
-		// Apply the blacklist to the results and record the before &
-		// after count.
-		addEngineResultCount(name, len(res))
-		res, n := blacklist.Filter(res)
-		addEngineDroppedCount(name, n)
-
-		results = append(results, res...)
+// Searches all requested engines.
+func doSearch(ctx context.Context, params searchParams) ([]search.Result, map[string]error, error) {
+	ps, err := startSearch(ctx, params)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	for name, eng := range engines {
-		if len(wantEngines) > 0 && !slices.Contains(wantEngines, name) {
-			continue
-		}
+	var errors map[string]error
+	results := map[string][]search.Result{}
 
-		wg.Add(1)
-		go fn(name, eng)
-	}
+	ps.collect(func(resp engineResponse) bool {
+		if resp.Err != nil {
+			if errors == nil {
+				// Lazily initialize the map.
+				// In most cases, there will be no errors so
+				// there's no point in allocating it.
+				errors = map[string]error{}
+			}
+
+			errors[resp.Name] = resp.Err
+			return true
+		}
 
-	wg.Wait()
+		results[resp.Name] = resp.Results
+		return true
+	})
 
 	// Check to see if all engines failed.
-	if len(errors) == len(engines) {
+	if len(errors) == len(ps.engines) {
 		// Everything did fail.
 		return nil, errors, errAllFailed
 	}
 
 	// Process the results and return.
-	return processResults(results), errors, nil
+	return ps.filter(processResults(results, params.Ranker)), errors, nil
 }
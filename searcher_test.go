@@ -1,11 +1,71 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"git.sr.ht/~cmcevoy/srchd/search"
 )
 
+// An engine that returns a fixed set of results.
+type staticEngine struct {
+	results []search.Result
+	err     error
+
+	// Time to wait before returning.
+	delay time.Duration
+
+	// Number of searches performed.
+	calls atomic.Int32
+}
+
+func (s *staticEngine) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *staticEngine) Search(ctx context.Context, query string, page int, opts search.Options) ([]search.Result, error) {
+	s.calls.Add(1)
+
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return cloneResults(s.results), s.err
+}
+
+// Replaces the running instance for the duration of a test.
+func setTestInstance(t *testing.T, st *instance) {
+	old := running.Swap(st)
+	t.Cleanup(func() {
+		running.Store(old)
+	})
+}
+
+// Replaces the engines of the running instance for the duration of a test.
+func setTestEngines(t *testing.T, e map[string]search.Engine) {
+	st := *current()
+	st.engines = e
+	setTestInstance(t, &st)
+
+	breakersMu.Lock()
+	oldBreakers := breakers
+	breakers = map[string]*circuitBreaker{}
+	breakersMu.Unlock()
+
+	t.Cleanup(func() {
+		breakersMu.Lock()
+		breakers = oldBreakers
+		breakersMu.Unlock()
+	})
+}
+
 func TestMergeResults(t *testing.T) {
 	results := []search.Result{
 		{Title: "1", Link: "1"},
@@ -16,7 +76,7 @@ func TestMergeResults(t *testing.T) {
 		{Title: "2", Link: "2"},
 	}
 
-	results = processResults(results)
+	results = processResults(map[string][]search.Result{"a": results}, voteRanker{})
 
 	for i, link := range []string{"1", "3", "2"} {
 		res := results[i].Link
@@ -25,3 +85,378 @@ func TestMergeResults(t *testing.T) {
 		}
 	}
 }
+
+func TestSearchDeadline(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"fast": &staticEngine{results: []search.Result{
+			{Title: "1", Link: "https://example.com/1", Sources: []string{"fast"}},
+		}},
+		"slow": &staticEngine{delay: time.Second},
+	})
+
+	then := time.Now()
+	res, errs, err := doSearch(context.Background(), searchParams{
+		Query:   "test",
+		Timeout: 50 * time.Millisecond,
+	})
+
+	if time.Since(then) >= time.Second {
+		t.Errorf("search waited for the slow engine")
+	}
+
+	if err != nil {
+		t.Fatalf("expected err = nil, got %v", err)
+	}
+
+	if len(res) != 1 {
+		t.Errorf("expected 1 result, got %d", len(res))
+	}
+
+	if !errors.Is(errs["slow"], errTimedOut) {
+		t.Errorf("expected slow engine to time out, got %v", errs["slow"])
+	}
+}
+
+func TestMergeResultsRRF(t *testing.T) {
+	results := map[string][]search.Result{
+		"a": {
+			{Title: "9", Link: "9", Rank: 9, Sources: []string{"a"}},
+			{Title: "1", Link: "1", Rank: 1, Sources: []string{"a"}},
+			{Title: "5", Link: "5", Rank: 5, Sources: []string{"a"}},
+			{Title: "8", Link: "8", Rank: 8, Sources: []string{"a"}},
+		},
+
+		// Returned by two engines near the bottom; this should outrank
+		// a single top result.
+		"b": {
+			{Title: "8", Link: "8", Rank: 8, Sources: []string{"b"}},
+		},
+	}
+
+	merged := processResults(results, rrfRanker{k: 60})
+
+	for i, link := range []string{"8", "1", "5", "9"} {
+		res := merged[i].Link
+		if res != link {
+			t.Errorf(`results[%d] = %q, not %q`, i, res, link)
+		}
+	}
+}
+
+func TestMergeResultsInterleave(t *testing.T) {
+	results := map[string][]search.Result{
+		"a": {
+			{Title: "a1", Link: "a1", Rank: 1, Sources: []string{"a"}},
+			{Title: "s", Link: "s", Rank: 2, Sources: []string{"a"}},
+			{Title: "a3", Link: "a3", Rank: 3, Sources: []string{"a"}},
+		},
+		"b": {
+			{Title: "b1", Link: "b1", Rank: 1, Sources: []string{"b"}},
+			{Title: "s", Link: "s", Rank: 2, Sources: []string{"b"}},
+			{Title: "b3", Link: "b3", Rank: 3, Sources: []string{"b"}},
+		},
+	}
+
+	merged := processResults(results, interleaveRanker{})
+
+	exp := []string{"a1", "b1", "s", "a3", "b3"}
+	if len(merged) != len(exp) {
+		t.Fatalf("expected %d results, got %d", len(exp), len(merged))
+	}
+
+	for i, link := range exp {
+		if merged[i].Link != link {
+			t.Errorf(`merged[%d] = %q, not %q`, i, merged[i].Link, link)
+		}
+	}
+
+	if len(merged[2].Sources) != 2 {
+		t.Errorf("expected duplicate to have 2 sources, got %v", merged[2].Sources)
+	}
+}
+
+func TestSearchPostFilter(t *testing.T) {
+	// staticEngine supports no operators, so site: must be checked by
+	// srchd.
+	setTestEngines(t, map[string]search.Engine{
+		"a": &staticEngine{results: []search.Result{
+			{Title: "1", Link: "https://example.com/1", Sources: []string{"a"}},
+			{Title: "2", Link: "https://example.org/2", Sources: []string{"a"}},
+			{Title: "3", Link: "https://www.example.com/3", Sources: []string{"a"}},
+		}},
+	})
+
+	res, _, err := doSearch(context.Background(), searchParams{
+		Query: "test site:example.com",
+	})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+
+	if len(res) != 2 || res[0].Title != "1" || res[1].Title != "3" {
+		t.Errorf("unexpected results: %v", res)
+	}
+}
+
+func TestProcessOperators(t *testing.T) {
+	want, exclude, query := processOperators(`:smallweb :-wiby hello \:world`)
+
+	if !slices.Equal(want, []string{"smallweb"}) {
+		t.Errorf("requested engines = %v", want)
+	}
+
+	if !slices.Equal(exclude, []string{"wiby"}) {
+		t.Errorf("excluded engines = %v", exclude)
+	}
+
+	if query != "hello :world" {
+		t.Errorf("query = %q", query)
+	}
+}
+
+func TestSearchGroups(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"a": &staticEngine{results: []search.Result{{Title: "a", Link: "https://a.example/", Sources: []string{"a"}}}},
+		"b": &staticEngine{results: []search.Result{{Title: "b", Link: "https://b.example/", Sources: []string{"b"}}}},
+		"c": &staticEngine{results: []search.Result{{Title: "c", Link: "https://c.example/", Sources: []string{"c"}}}},
+	})
+
+	st := *current()
+	c := *st.cfg
+	c.Groups = map[string][]string{"ab": {"a", "b"}}
+	st.cfg = &c
+	setTestInstance(t, &st)
+
+	tests := []struct {
+		query   string
+		engines []string
+		want    []string
+	}{
+		{"test", nil, []string{"a", "b", "c"}},
+		{"test :ab", nil, []string{"a", "b"}},
+		{"test :ab :-b", nil, []string{"a"}},
+		{"test :-ab", nil, []string{"c"}},
+		{"test", []string{"ab"}, []string{"a", "b"}},
+		{"test :-a", []string{"ab"}, []string{"b"}},
+		{"test :c", []string{"ab"}, []string{"c"}},
+	}
+
+	for _, v := range tests {
+		t.Run(v.query, func(t *testing.T) {
+			res, _, err := doSearch(context.Background(), searchParams{
+				Query:   v.query,
+				Engines: v.engines,
+			})
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+
+			got := []string{}
+			for _, r := range res {
+				got = append(got, r.Title)
+			}
+			slices.Sort(got)
+
+			if !slices.Equal(got, v.want) {
+				t.Errorf("searched %v, want %v", got, v.want)
+			}
+		})
+	}
+}
+
+// A staticEngine that also supports the news category.
+type newsEngine struct {
+	staticEngine
+}
+
+func (n *newsEngine) Categories() []search.Category {
+	return []search.Category{search.CategoryNews}
+}
+
+func (n *newsEngine) SearchCategory(ctx context.Context, category search.Category, query string, page int, opts search.Options) ([]search.Result, error) {
+	res, err := n.Search(ctx, query, page, opts)
+	for i := range res {
+		res[i].Title += " (news)"
+	}
+	return res, err
+}
+
+func TestSearchCategory(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"web":  &staticEngine{results: []search.Result{{Title: "web", Link: "https://web.example/", Sources: []string{"web"}}}},
+		"news": &newsEngine{staticEngine{results: []search.Result{{Title: "news", Link: "https://news.example/", Sources: []string{"news"}}}}},
+	})
+
+	res, _, err := doSearch(context.Background(), searchParams{
+		Query:    "test",
+		Category: search.CategoryNews,
+	})
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+
+	if len(res) != 1 || res[0].Title != "news (news)" {
+		t.Errorf("unexpected results: %v", res)
+	}
+
+	_, _, err = doSearch(context.Background(), searchParams{
+		Query:    "test",
+		Category: search.CategoryImages,
+	})
+	if err != errNoEngines {
+		t.Errorf("searching images: err = %v, want %v", err, errNoEngines)
+	}
+}
+
+func TestSearchCapabilities(t *testing.T) {
+	// Engines are looked up by type, and these have registered
+	// capabilities.
+	setTestEngines(t, map[string]search.Engine{
+		"mediawiki": &staticEngine{results: []search.Result{{Title: "mediawiki", Link: "https://mediawiki.example/", Sources: []string{"mediawiki"}}}},
+		"wiby":      &staticEngine{results: []search.Result{{Title: "wiby", Link: "https://wiby.example/", Sources: []string{"wiby"}}}},
+		"other":     &staticEngine{results: []search.Result{{Title: "other", Link: "https://other.example/", Sources: []string{"other"}}}},
+	})
+
+	tests := []struct {
+		name   string
+		params searchParams
+		want   []string
+	}{
+		{"first page", searchParams{Query: "test"}, []string{"mediawiki", "other", "wiby"}},
+		{"second page", searchParams{Query: "test", Page: 1}, []string{"other", "wiby"}},
+		{"language", searchParams{Query: "test", Options: search.Options{Language: "de"}}, []string{"mediawiki", "other"}},
+	}
+
+	for _, v := range tests {
+		t.Run(v.name, func(t *testing.T) {
+			ps, err := startSearch(context.Background(), v.params)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			for range ps.ch {
+			}
+
+			slices.Sort(ps.engines)
+			if !slices.Equal(ps.engines, v.want) {
+				t.Errorf("searched %v, want %v", ps.engines, v.want)
+			}
+		})
+	}
+}
+
+func TestSearchSuspended(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"ok":      &staticEngine{results: []search.Result{{Title: "ok", Link: "https://ok.example/", Sources: []string{"ok"}}}},
+		"captcha": &staticEngine{err: search.ErrCaptcha},
+	})
+
+	for i := range 2 {
+		_, errs, err := doSearch(context.Background(), searchParams{Query: "test"})
+		if err != nil {
+			t.Fatalf("search failed: %v", err)
+		}
+
+		// The first search trips the breaker, and the second one
+		// doesn't reach the engine at all.
+		want := search.ErrCaptcha
+		if i > 0 {
+			want = errSuspended
+		}
+
+		if !errors.Is(errs["captcha"], want) {
+			t.Errorf("search %d: err = %v, want %v", i, errs["captcha"], want)
+		}
+	}
+
+	if getEngineBreakerStatus("captcha").State != breakerOpen {
+		t.Errorf("engine was not suspended")
+	}
+}
+
+func TestSearchCoalescing(t *testing.T) {
+	eng := &staticEngine{
+		results: []search.Result{{Title: "a", Link: "https://a.example/", Sources: []string{"a"}}},
+		delay:   100 * time.Millisecond,
+	}
+	setTestEngines(t, map[string]search.Engine{"a": eng})
+
+	before := getEngineCoalescedCount("a")
+
+	wg := sync.WaitGroup{}
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res := searchEngine(context.Background(), current(), "a", eng, engineRequest{Category: search.CategoryWeb, Query: "coalesce"})
+			if res.Err != nil || len(res.Results) != 1 {
+				t.Errorf("unexpected response: %+v", res)
+				return
+			}
+
+			// Results must not be shared between searches.
+			res.Results[0].Sources[0] = "modified"
+		}()
+	}
+	wg.Wait()
+
+	if n := eng.calls.Load(); n != 1 {
+		t.Errorf("engine was searched %d times, want 1", n)
+	}
+
+	if n := getEngineCoalescedCount("a") - before; n != 4 {
+		t.Errorf("coalesced count = %d, want 4", n)
+	}
+}
+
+func TestSearchEngineCancel(t *testing.T) {
+	eng := &staticEngine{
+		results: []search.Result{{Title: "a", Link: "https://a.example/", Sources: []string{"a"}}},
+		delay:   time.Second,
+	}
+	setTestEngines(t, map[string]search.Engine{"a": eng})
+
+	st := *current()
+	st.cache = nil
+	setTestInstance(t, &st)
+
+	// Without a cache, nothing is left to wait for once the search is
+	// gone.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	then := time.Now()
+	res := searchEngine(ctx, &st, "a", eng, engineRequest{Category: search.CategoryWeb, Query: "cancel"})
+	if !errors.Is(res.Err, context.DeadlineExceeded) {
+		t.Errorf("expected the search to be canceled, got %+v", res)
+	}
+	if d := time.Since(then); d > 500*time.Millisecond {
+		t.Errorf("search took %v after being canceled", d)
+	}
+}
+
+func TestSearchEngineSharedCancel(t *testing.T) {
+	eng := &staticEngine{
+		results: []search.Result{{Title: "a", Link: "https://a.example/", Sources: []string{"a"}}},
+		delay:   50 * time.Millisecond,
+	}
+	setTestEngines(t, map[string]search.Engine{"a": eng})
+
+	st := *current()
+	st.cache = nil
+	setTestInstance(t, &st)
+
+	req := engineRequest{Category: search.CategoryWeb, Query: "shared cancel"}
+
+	// The first search starts the request and goes away while the second
+	// one waits on it.
+	ctx, cancel := context.WithCancel(context.Background())
+	go searchEngine(ctx, &st, "a", eng, req)
+	time.Sleep(10 * time.Millisecond)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	res := searchEngine(context.Background(), &st, "a", eng, req)
+	if res.Err != nil || len(res.Results) != 1 {
+		t.Errorf("expected results for the remaining search, got %+v", res)
+	}
+}
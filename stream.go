@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+// Payload of the "results" and "error" server-sent events.
+type streamEngineEvent struct {
+	Engine  string          `json:"engine"`
+	Results []search.Result `json:"results,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Payload of the "done" server-sent event.
+type streamDoneEvent struct {
+	Results []search.Result   `json:"results,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// Payload of the "redirect" server-sent event.
+type streamRedirectEvent struct {
+	URL string `json:"url"`
+}
+
+// Data passed to the templates in stream.html.
+type streamTmplData struct {
+	tmplData
+
+	// Name of the engine whose results are being rendered.
+	Engine string
+
+	// Total number of results that have been shown so far.
+	Shown int
+}
+
+// Determines if the user wants search results to be streamed as engines
+// finish.
+//
+// This can be set per request with the "stream" parameter, or in the
+// settings.
+func wantsStreaming(r *http.Request) bool {
+	if v := r.FormValue("stream"); v != "" {
+		return v == "1"
+	}
+
+	cookie, err := r.Cookie("stream")
+	return err == nil && cookie.Value == "1"
+}
+
+// Writes a single server-sent event.
+func writeEvent(w io.Writer, event string, data any) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, buf)
+	return err
+}
+
+// Streams search results using server-sent events.
+//
+// A "results" or "error" event is sent for every engine as soon as it has
+// finished, and a "done" event containing the merged and ranked results is
+// sent once all engines have finished.
+// If the query uses a bang, a single "redirect" event holding the link is sent
+// instead and no engine is searched.
+func httpSearchStream(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSearchParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// A redirect would be followed by the client, which expects events.
+	if link, ok := current().bangs.Redirect(params.Query); ok {
+		writeEvent(w, "redirect", streamRedirectEvent{URL: link})
+		return
+	}
+
+	ps, err := startSearch(r.Context(), params)
+	if err != nil {
+		writeEvent(w, "done", streamDoneEvent{Error: err.Error()})
+		return
+	}
+
+	done := streamDoneEvent{}
+	results := map[string][]search.Result{}
+	failed := 0
+
+	ps.collect(func(resp engineResponse) bool {
+		ev := streamEngineEvent{Engine: resp.Name}
+
+		if resp.Err != nil {
+			if done.Errors == nil {
+				done.Errors = map[string]string{}
+			}
+			done.Errors[resp.Name] = resp.Err.Error()
+			failed++
+
+			ev.Error = resp.Err.Error()
+			err = writeEvent(w, "error", ev)
+		} else {
+			results[resp.Name] = resp.Results
+
+			// Prepared the same way as the merged results, leaving
+			// the originals to be merged at the end.
+			ev.Results = ps.filter(prepareResults(slices.Clone(resp.Results)))
+			err = writeEvent(w, "results", ev)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		return err == nil
+	})
+
+	if err != nil {
+		// The client went away; the remaining engines will finish on
+		// their own.
+		logHTTP.Warn("streaming search results failed", "err", err)
+		return
+	}
+
+	if failed == len(ps.engines) {
+		done.Error = errAllFailed.Error()
+	} else {
+		done.Results = ps.filter(processResults(results, params.Ranker))
+	}
+
+	writeEvent(w, "done", done)
+}
+
+// Renders the results page progressively as engines finish.
+//
+// Results are shown in the order that they arrive in, as results that have
+// already been sent cannot be reordered.
+func httpSearchProgressive(w http.ResponseWriter, r *http.Request, params searchParams) {
+	rc := http.NewResponseController(w)
+
+	data := streamTmplData{
+		tmplData: tmplData{
+			Title:    params.Query,
+			Query:    params.Query,
+			Page:     params.Page,
+			Category: params.Category,
+			BaseURL:  cfg().BaseURL,
+		},
+	}
+
+	ps, err := startSearch(r.Context(), params)
+	if err != nil {
+		data.Error = err
+		templateExecute(w, "stream_head", data)
+		templateExecute(w, "stream_tail", data)
+		return
+	}
+
+	templateExecute(w, "stream_head", data)
+	rc.Flush()
+
+	// Canonical forms of the links that have already been shown.
+	seen := map[string]struct{}{}
+
+	ps.collect(func(resp engineResponse) bool {
+		if resp.Err != nil {
+			if data.Errors == nil {
+				data.Errors = map[string]error{}
+			}
+			data.Errors[resp.Name] = resp.Err
+			return true
+		}
+
+		data.Engine = resp.Name
+		data.Results = data.Results[:0]
+
+		ranked := ps.filter(processResults(map[string][]search.Result{
+			resp.Name: resp.Results,
+		}, params.Ranker))
+
+		for _, res := range ranked {
+			// Compared the same way mergeResults does.
+			key := canonicalLink(res.Link)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+
+			seen[key] = struct{}{}
+			data.Results = append(data.Results, res)
+		}
+
+		data.Shown += len(data.Results)
+
+		templateExecute(w, "stream_results", data)
+		return rc.Flush() == nil
+	})
+
+	if len(data.Errors) == len(ps.engines) {
+		data.Error = errAllFailed
+	}
+
+	data.Engine = ""
+	data.Results = nil
+
+	templateExecute(w, "stream_tail", data)
+}
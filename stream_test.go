@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~cmcevoy/srchd/search"
+)
+
+func TestSearchStream(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"a": &staticEngine{results: []search.Result{
+			{Title: "1", Link: "https://example.com/1", Sources: []string{"a"}},
+		}},
+		"b": &staticEngine{err: errors.New("broken")},
+	})
+
+	r := httptest.NewRequest("GET", "/search/stream?q=test", nil)
+	w := httptest.NewRecorder()
+	httpSearchStream(w, r)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	events := map[string]string{}
+	sc := bufio.NewScanner(w.Body)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+			events[event] = v
+		}
+	}
+
+	for _, ev := range []string{"results", "error", "done"} {
+		if _, ok := events[ev]; !ok {
+			t.Errorf("missing %q event", ev)
+		}
+	}
+
+	done := streamDoneEvent{}
+	if err := json.Unmarshal([]byte(events["done"]), &done); err != nil {
+		t.Fatalf("failed to decode done event: %v", err)
+	}
+
+	if len(done.Results) != 1 || done.Results[0].Link != "https://example.com/1" {
+		t.Errorf("unexpected merged results %+v", done.Results)
+	}
+
+	if done.Errors["b"] != "broken" {
+		t.Errorf("expected error for b, got %+v", done.Errors)
+	}
+}
+
+func TestSearchStreamPrepared(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"a": &staticEngine{results: []search.Result{
+			{Title: "1", Link: "https://example.com/1", Sources: []string{"a"}},
+			{Title: "2", Link: "https://removed.com/2", Sources: []string{"a"}},
+		}},
+	})
+
+	st := *current()
+	c := *st.cfg
+	c.Rewrite = []rewriteRule{{Hostname: "removed.com"}}
+	st.cfg = &c
+	setTestInstance(t, &st)
+
+	r := httptest.NewRequest("GET", "/search/stream?q=test", nil)
+	w := httptest.NewRecorder()
+	httpSearchStream(w, r)
+
+	var ev streamEngineEvent
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "event: "); ok && v == "results" {
+			sc.Scan()
+			data, _ := strings.CutPrefix(sc.Text(), "data: ")
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				t.Fatalf("failed to decode results event: %v", err)
+			}
+		}
+	}
+
+	if len(ev.Results) != 1 || ev.Results[0].Link != "https://example.com/1" {
+		t.Errorf("expected removed links to be dropped, got %+v", ev.Results)
+	}
+}
+
+func TestSearchProgressiveDuplicates(t *testing.T) {
+	setTestEngines(t, map[string]search.Engine{
+		"a": &staticEngine{results: []search.Result{
+			{Title: "first", Link: "https://example.com/1", Sources: []string{"a"}},
+		}},
+		"b": &staticEngine{delay: 10 * time.Millisecond, results: []search.Result{
+			{Title: "second", Link: "http://www.example.com/1", Sources: []string{"b"}},
+		}},
+	})
+
+	r := httptest.NewRequest("GET", "/search?q=test&stream=1", nil)
+	w := httptest.NewRecorder()
+	httpSearchProgressive(w, r, searchParams{Query: "test"})
+
+	body := w.Body.String()
+	if !strings.Contains(body, "first") || strings.Contains(body, "second") {
+		t.Errorf("expected the variant of a shown link to be left out:\n%s", body)
+	}
+}
+
+func TestSearchStreamBang(t *testing.T) {
+	eng := &staticEngine{}
+	setTestEngines(t, map[string]search.Engine{"a": eng})
+
+	st := *current()
+	st.bangs = newBangList()
+	st.bangs.Add("w", "Wikipedia", "https://en.wikipedia.org/w/index.php?search={{{s}}}")
+	setTestInstance(t, &st)
+
+	r := httptest.NewRequest("GET", "/search/stream?q=%21w+foo", nil)
+	w := httptest.NewRecorder()
+	httpSearchStream(w, r)
+
+	want := "event: redirect\ndata: {\"url\":\"https://en.wikipedia.org/w/index.php?search=foo\"}\n\n"
+	if body := w.Body.String(); body != want {
+		t.Errorf("expected a single redirect event, got:\n%s", body)
+	}
+
+	if n := eng.calls.Load(); n != 0 {
+		t.Errorf("engine was searched %d times", n)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Windows shown on the stats page.
+var statWindows = []struct {
+	Name string
+	Span time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// Resolution and length of the history kept for each engine.
+const (
+	windowResolution = time.Minute
+	windowBuckets    = 24 * 60
+)
+
+// Request durations are counted in buckets that grow by latencyFactor, from
+// minLatency up to a bucket that holds everything slower.
+const (
+	minLatency     = 10 * time.Millisecond
+	latencyFactor  = 1.25
+	latencyBuckets = 40
+)
+
+// The searches of an engine during one windowResolution.
+type windowBucket struct {
+	// The index of the period this bucket holds, in units of
+	// windowResolution since the Unix epoch.
+	period int64
+
+	requests int
+	errors   int
+	results  int
+	latency  [latencyBuckets]uint32
+}
+
+// engineWindow holds the searches of an engine over the last 24 hours.
+type engineWindow struct {
+	mu      sync.Mutex
+	buckets [windowBuckets]windowBucket
+}
+
+// A summary of the searches of an engine over a window of time.
+type windowSummary struct {
+	// Name of the window, e.g. "5m".
+	Window string `json:"window"`
+
+	Requests int `json:"requests"`
+
+	// Fraction of requests that failed, from 0 to 1.
+	ErrorRate float64 `json:"error_rate"`
+
+	// Average number of results of successful requests.
+	ResultsPerQuery float64 `json:"results_per_query"`
+
+	// Percentiles of the request duration, in nanoseconds in JSON.
+	// These are estimates that can be off by up to a quarter.
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+}
+
+// Returns the error rate as a percentage.
+func (s windowSummary) ErrorPercent() float64 {
+	return s.ErrorRate * 100
+}
+
+var engineWindows = map[string]*engineWindow{}
+var engineWindowsMu sync.Mutex
+
+// Returns the window of an engine, creating it if needed.
+func getEngineWindow(name string) *engineWindow {
+	engineWindowsMu.Lock()
+	defer engineWindowsMu.Unlock()
+
+	w, ok := engineWindows[name]
+	if !ok {
+		w = &engineWindow{}
+		engineWindows[name] = w
+	}
+	return w
+}
+
+// Returns the latency bucket of a duration.
+func latencyBucket(d time.Duration) int {
+	if d <= minLatency {
+		return 0
+	}
+
+	i := int(math.Ceil(math.Log(float64(d)/float64(minLatency)) / math.Log(latencyFactor)))
+	return min(i, latencyBuckets-1)
+}
+
+// Returns the upper bound of a latency bucket, rounded for display.
+func latencyBound(i int) time.Duration {
+	return time.Duration(float64(minLatency) * math.Pow(latencyFactor, float64(i))).Round(time.Millisecond)
+}
+
+// Records a search.
+func (w *engineWindow) record(t time.Time, d time.Duration, results int, err error) {
+	period := t.UnixNano() / int64(windowResolution)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	b := &w.buckets[period%windowBuckets]
+	if b.period != period {
+		// This bucket last held a period that is over 24 hours old.
+		*b = windowBucket{period: period}
+	}
+
+	b.requests++
+	if err != nil {
+		b.errors++
+	} else {
+		b.results += results
+	}
+	b.latency[latencyBucket(d)]++
+}
+
+// Summarizes the searches made within span before now.
+func (w *engineWindow) summary(now time.Time, name string, span time.Duration) windowSummary {
+	last := now.UnixNano() / int64(windowResolution)
+	first := last - int64(span/windowResolution) + 1
+
+	var total windowBucket
+
+	w.mu.Lock()
+	for p := max(first, last-windowBuckets+1); p <= last; p++ {
+		b := &w.buckets[p%windowBuckets]
+		if b.period != p {
+			continue
+		}
+
+		total.requests += b.requests
+		total.errors += b.errors
+		total.results += b.results
+		for i, v := range b.latency {
+			total.latency[i] += v
+		}
+	}
+	w.mu.Unlock()
+
+	s := windowSummary{Window: name, Requests: total.requests}
+	if total.requests == 0 {
+		return s
+	}
+
+	s.ErrorRate = float64(total.errors) / float64(total.requests)
+	if ok := total.requests - total.errors; ok > 0 {
+		s.ResultsPerQuery = float64(total.results) / float64(ok)
+	}
+
+	s.P50 = total.percentile(0.5)
+	s.P90 = total.percentile(0.9)
+	s.P99 = total.percentile(0.99)
+	return s
+}
+
+// Estimates a percentile of the request duration as the upper bound of the
+// latency bucket it falls in.
+func (b *windowBucket) percentile(p float64) time.Duration {
+	rank := uint32(math.Ceil(p * float64(b.requests)))
+
+	var seen uint32
+	for i, v := range b.latency {
+		seen += v
+		if seen >= rank {
+			return latencyBound(i)
+		}
+	}
+
+	return latencyBound(latencyBuckets - 1)
+}
+
+// Returns the summaries of all windows for an engine.
+func getEngineWindows(name string) []windowSummary {
+	w := getEngineWindow(name)
+	now := time.Now()
+
+	out := make([]windowSummary, len(statWindows))
+	for i, v := range statWindows {
+		out[i] = w.summary(now, v.Name, v.Span)
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngineWindow(t *testing.T) {
+	w := &engineWindow{}
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	// Two hours ago: only in the 24 hour window.
+	w.record(now.Add(-2*time.Hour), 5*time.Second, 0, errors.New("failed"))
+
+	// Within the last 5 minutes.
+	for i := range 100 {
+		w.record(now.Add(-time.Minute), time.Duration(i+1)*10*time.Millisecond, 10, nil)
+	}
+
+	recent := w.summary(now, "5m", 5*time.Minute)
+	if recent.Requests != 100 || recent.ErrorRate != 0 || recent.ResultsPerQuery != 10 {
+		t.Errorf("unexpected 5m summary: %+v", recent)
+	}
+
+	// Percentiles are rounded up to the next bucket, up to a quarter.
+	for _, v := range []struct {
+		got, want time.Duration
+	}{
+		{recent.P50, 500 * time.Millisecond},
+		{recent.P90, 900 * time.Millisecond},
+		{recent.P99, 990 * time.Millisecond},
+	} {
+		if v.got < v.want || float64(v.got) > float64(v.want)*latencyFactor {
+			t.Errorf("percentile = %v, want about %v", v.got, v.want)
+		}
+	}
+
+	day := w.summary(now, "24h", 24*time.Hour)
+	if day.Requests != 101 || day.ErrorRate != 1.0/101 {
+		t.Errorf("unexpected 24h summary: %+v", day)
+	}
+
+	// A day later, the old searches are gone.
+	if s := w.summary(now.Add(25*time.Hour), "24h", 24*time.Hour); s.Requests != 0 {
+		t.Errorf("searches older than a day were kept: %+v", s)
+	}
+
+	// Buckets are reused after a day.
+	w.record(now.Add(24*time.Hour-time.Minute), time.Second, 1, nil)
+	if s := w.summary(now.Add(24*time.Hour), "5m", 5*time.Minute); s.Requests != 1 {
+		t.Errorf("reused bucket kept old searches: %+v", s)
+	}
+}